@@ -0,0 +1,54 @@
+package apa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/innerr/tiperf/apa/annotation"
+)
+
+// The annotations are shown in the matched periods when detecting
+func (a *AutoPerfAssistant) LoadAnnotations(path string) (err error) {
+	a.annotations, err = annotation.LoadStore(path)
+	return
+}
+
+// Annotate a point in time if `at` is specified, otherwise the analyze range
+func (a *AutoPerfAssistant) AddAnnotation(note string, at time.Time, boundary bool) error {
+	from, to := at, at
+	if at.IsZero() {
+		if !a.timeRange.Valid() {
+			return fmt.Errorf("the time of the annotation should be specified by --at, or --from/--to/--duration")
+		}
+		from, to = a.timeRange.From, a.timeRange.To
+	}
+	annotation, err := a.annotations.Add(from, to, note, boundary)
+	if err != nil {
+		return err
+	}
+	err = a.annotations.Save()
+	if err != nil {
+		return err
+	}
+	a.con.Compact("added ", annotation, "\n")
+	return nil
+}
+
+func (a *AutoPerfAssistant) DeleteAnnotation(id int) error {
+	err := a.annotations.Delete(id)
+	if err != nil {
+		return err
+	}
+	return a.annotations.Save()
+}
+
+// List the annotations in the analyze range, or all if the range is not specified
+func (a *AutoPerfAssistant) ListAnnotations() {
+	annotations := a.annotations.Annotations
+	if a.timeRange.Valid() {
+		annotations = a.annotations.Find(a.timeRange.From, a.timeRange.To)
+	}
+	for _, it := range annotations {
+		a.con.Compact(it, "\n")
+	}
+}
@@ -0,0 +1,136 @@
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+// A user note of a time range, From equals To means a point in time.
+// A boundary annotation forces a period boundary at From.
+type Annotation struct {
+	ID       int
+	From     time.Time
+	To       time.Time
+	Note     string
+	Boundary bool `json:",omitempty"`
+	Created  time.Time
+}
+
+func (a Annotation) IsPoint() bool {
+	return a.From.Equal(a.To)
+}
+
+func (a Annotation) Overlaps(start time.Time, end time.Time) bool {
+	if a.IsPoint() {
+		return !a.From.Before(start) && a.From.Before(end)
+	}
+	return a.From.Before(end) && a.To.After(start)
+}
+
+func (a Annotation) String() string {
+	at := a.From.In(base.Location).Format(base.TimeFormat)
+	if !a.IsPoint() {
+		at += " => " + a.To.In(base.Location).Format(base.TimeFormat)
+	}
+	boundary := ""
+	if a.Boundary {
+		boundary = " (boundary)"
+	}
+	return fmt.Sprintf("#%d %s%s: %s", a.ID, at, boundary, a.Note)
+}
+
+// The annotations are stored in a json file
+type Store struct {
+	path        string
+	Annotations []Annotation
+}
+
+// Return an empty store if the file not exists
+func LoadStore(path string) (store *Store, err error) {
+	store = &Store{path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &store.Annotations)
+	if err != nil {
+		err = fmt.Errorf("parsing annotations file %s: %v", path, err)
+	}
+	return
+}
+
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s.Annotations, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, data, 0644)
+}
+
+// The ID is assigned by the store, return the added one
+func (s *Store) Add(from time.Time, to time.Time, note string, boundary bool) (annotation Annotation, err error) {
+	if len(note) == 0 {
+		err = fmt.Errorf("the note of annotation should not be empty")
+		return
+	}
+	if to.Before(from) {
+		err = fmt.Errorf("the annotation range is inverted: %s => %s", from.Format(base.TimeFormat), to.Format(base.TimeFormat))
+		return
+	}
+	id := 1
+	for _, it := range s.Annotations {
+		if it.ID >= id {
+			id = it.ID + 1
+		}
+	}
+	annotation = Annotation{id, from, to, note, boundary, time.Now()}
+	s.Annotations = append(s.Annotations, annotation)
+	sort.SliceStable(s.Annotations, func(i, j int) bool {
+		return s.Annotations[i].From.Before(s.Annotations[j].From)
+	})
+	return
+}
+
+func (s *Store) Delete(id int) error {
+	for i, it := range s.Annotations {
+		if it.ID == id {
+			s.Annotations = append(s.Annotations[:i], s.Annotations[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("annotation not found: #%d", id)
+}
+
+// The annotations overlapped with [start, end), sorted by time
+func (s *Store) Find(start time.Time, end time.Time) (found []Annotation) {
+	for _, it := range s.Annotations {
+		if it.Overlaps(start, end) {
+			found = append(found, it)
+		}
+	}
+	return
+}
+
+// The boundary annotations in [start, end)
+func (s *Store) Boundaries(start time.Time, end time.Time) (found []Annotation) {
+	for _, it := range s.Find(start, end) {
+		if it.Boundary {
+			found = append(found, it)
+		}
+	}
+	return
+}
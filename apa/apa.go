@@ -1,13 +1,20 @@
 package apa
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/innerr/tiperf/apa/annotation"
 	"github.com/innerr/tiperf/apa/base"
 	"github.com/innerr/tiperf/apa/detectors"
+	"github.com/innerr/tiperf/apa/fingerprint"
+	"github.com/innerr/tiperf/apa/history"
 	"github.com/innerr/tiperf/apa/sources"
+	"github.com/innerr/tiperf/apa/tuning"
 )
 
 type AutoPerfAssistant struct {
@@ -16,15 +23,107 @@ type AutoPerfAssistant struct {
 
 	timeRange   base.TimeRange
 	periodCount int
+
+	rules        tuning.Rules
+	seasonality  base.Seasonality
+	fingerprints *fingerprint.Library
+	minPeriod    time.Duration
+
+	// The similarity thresholds of the period tree levels, and the level `periodCount` applies at.
+	// Empty means one level, by the breaking function of the workload source.
+	thresholds  []float64
+	periodLevel int
+
+	annotations *annotation.Store
+	output      string
+
+	// Nil if the history is disabled or failed to open, the opening error is kept for the report
+	history    *history.Store
+	historyErr error
+	cluster    string
+
+	// The workload vectors fetched in detecting periods, reused in the output
+	workload []base.CollectedSourceTasks
 }
 
-func NewAutoPerfAssistant(verbLevel string, timeRange base.TimeRange, periodCount int) *AutoPerfAssistant {
+func NewAutoPerfAssistant(verbLevel string, timeRange base.TimeRange, periodCount int) (*AutoPerfAssistant, error) {
+	con, err := base.NewConsole(verbLevel)
+	if err != nil {
+		return nil, err
+	}
 	return &AutoPerfAssistant{
 		make(sources.Sources),
-		base.NewConsole(verbLevel),
+		con,
 		timeRange,
 		periodCount,
+		tuning.DefaultRules(),
+		base.Seasonality{},
+		&fingerprint.Library{},
+		base.MinPeriodDuration,
+		nil,
+		0,
+		&annotation.Store{},
+		"text",
+		nil,
+		nil,
+		"",
+		nil,
+	}, nil
+}
+
+// The loaded rules with the same names override the default ones
+func (a *AutoPerfAssistant) AddTuningRules(path string) error {
+	rules, err := tuning.LoadRules(path)
+	if err != nil {
+		return err
 	}
+	a.rules = a.rules.Merge(rules)
+	return nil
+}
+
+// Each threshold is a level of the period tree, the lower one makes the coarser periods.
+// The period count limit applies at the specified level.
+// Without thresholds, the periods are split by the breaking function of the workload source in one level.
+func (a *AutoPerfAssistant) SetPeriodLevels(thresholds []float64, level int) error {
+	if len(thresholds) == 0 {
+		if level != 0 {
+			return fmt.Errorf("period level should be 0 without thresholds, got: %d", level)
+		}
+		a.thresholds = nil
+		a.periodLevel = 0
+		return nil
+	}
+	for _, threshold := range thresholds {
+		if threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("period similarity threshold should be in (0, 1], got: %v", threshold)
+		}
+	}
+	if level < 0 || level >= len(thresholds) {
+		return fmt.Errorf("period level should be in [0, %d), got: %d", len(thresholds), level)
+	}
+	a.thresholds = append([]float64{}, thresholds...)
+	sort.Float64s(a.thresholds)
+	a.periodLevel = level
+	return nil
+}
+
+// The shorter periods are merged into the neighbours or marked as transitions, 0 means no limit
+func (a *AutoPerfAssistant) SetMinPeriodDuration(duration time.Duration) {
+	a.minPeriod = duration
+}
+
+// Should be: text|json|markdown
+func (a *AutoPerfAssistant) SetOutput(format string) error {
+	switch format {
+	case "text", "json", "markdown":
+		a.output = format
+		if format != "text" {
+			// Keep stdout parseable, the diagnostics go to stderr
+			a.con = a.con.WithWriter(os.Stderr)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format: '" + format + "', should be: text, json, markdown")
 }
 
 func (a *AutoPerfAssistant) AddPrometheus(host string, port int) error {
@@ -49,28 +148,65 @@ func (a *AutoPerfAssistant) DetectPeriods() (periods []base.Period, err error) {
 		a.con.Debug("## args: analyze last ", a.periodCount, " period(s)\n")
 	}
 
-	now := time.Now()
+	now := base.Now()
 
 	end := a.timeRange.To
 	start := a.timeRange.From
 	if autoMode {
-		end = now
+		// Only `to` is specified, or nothing
+		if end.IsZero() {
+			end = now
+		}
 		start = end.Add(-base.AutoModeStartDuration)
 	}
 	duration := end.Sub(start)
 
+	// Without levels specified, one level by the breaking function of the workload source
+	thresholds := a.thresholds
+	if len(thresholds) == 0 {
+		var threshold float64
+		threshold, err = base.ParseGroupBreakingThreshold(base.GetPeriodWorkloadBreakingPointSource())
+		if err != nil {
+			return
+		}
+		thresholds = []float64{threshold}
+	}
+
+	// If detecting failed in a larger range, the result of the previous range is used,
+	// if it failed in the first range, the whole range is analyzed as one period
+	var partialErr error
+	var prevPeriods []base.Period
+	var workload, prevWorkload []base.CollectedSourceTasks
 	for {
 		period := base.Period{
-			start,
-			end,
-			"start",
-			"end",
+			Start:       start,
+			End:         end,
+			StartReason: "start",
+			EndReason:   "end",
 		}
-		periods, err = detectors.DetectWorkloadPeriods(a.data, period, a.con)
-		if err != nil {
-			return
+		periods, workload, partialErr = detectors.DetectWorkloadPeriods(a.data, period, a.seasonality, a.con, thresholds...)
+		if partialErr != nil {
+			partialErr = base.StepError{
+				Step: "detect workload periods in " + period.Start.Format(base.TimeFormat) + " => " + period.End.Format(base.TimeFormat),
+				Err:  partialErr,
+			}
+			if !base.IsPartial(partialErr) {
+				if len(prevPeriods) == 0 {
+					a.con.Debug("## detecting failed, use the whole range as one period: ", partialErr, "\n")
+					periods = []base.Period{period}
+				} else {
+					a.con.Debug("## detecting failed, use the result of the previous range: ", partialErr, "\n")
+					periods = prevPeriods
+					workload = prevWorkload
+				}
+				partialErr = &base.PartialError{Errors: []error{partialErr}}
+				break
+			}
 		}
-		if a.periodCount > 0 && len(periods) > a.periodCount {
+		periods = base.MergeShortPeriods(periods, a.minPeriod, thresholds, a.con)
+		prevPeriods = periods
+		prevWorkload = workload
+		if a.periodCount > 0 && countFullPeriods(base.FlattenPeriods(periods, a.periodLevel)) > a.periodCount {
 			break
 		}
 		if a.periodCount == 0 && len(periods) != 0 {
@@ -81,14 +217,14 @@ func (a *AutoPerfAssistant) DetectPeriods() (periods []base.Period, err error) {
 			if a.periodCount == 0 {
 				a.con.Debug("## detected nothing in max duration\n")
 			} else {
-				a.con.Debug("## detected ", len(periods), "/", a.periodCount, " period(s), reached max duration\n")
+				a.con.Debug("## detected ", countFullPeriods(base.FlattenPeriods(periods, a.periodLevel)), "/", a.periodCount, " period(s), reached max duration\n")
 			}
 			break
 		} else {
 			if a.periodCount == 0 {
 				a.con.Debug("## detected nothing")
 			} else {
-				a.con.Debug("## detected ", len(periods), "/", a.periodCount, " period(s)")
+				a.con.Debug("## detected ", countFullPeriods(base.FlattenPeriods(periods, a.periodLevel)), "/", a.periodCount, " period(s)")
 			}
 			a.con.Debug(", increasing duration: ", duration, " => ")
 			duration *= 2
@@ -98,19 +234,81 @@ func (a *AutoPerfAssistant) DetectPeriods() (periods []base.Period, err error) {
 	}
 
 	a.con.Debug("## dectected ", len(periods), " periods by workload\n")
+	a.workload = workload
+
+	if len(periods) != 0 {
+		for _, it := range a.annotations.Boundaries(periods[0].Start, periods[len(periods)-1].End) {
+			a.con.Debug("## forced boundary at ", it.From.Format(base.TimeFormat), " by annotation #", it.ID, "\n")
+			periods = base.SplitPeriods(periods, it.From, base.ForcedBreakingReason{Note: it.Note})
+		}
+	}
 
 	periods, err = a.removePeriods(periods)
 	if err != nil {
 		return
 	}
+
+	if a.seasonality.Valid() {
+		var seasonalErr error
+		periods, seasonalErr = a.judgeSeasonality(periods)
+		if seasonalErr != nil {
+			partial := base.PartialError{}
+			partial.Add(partialErr)
+			partial.Add(seasonalErr)
+			partialErr = partial.Err()
+		}
+	}
+
+	err = partialErr
+	return
+}
+
+// The workload of the breaking reasons, or the average of the workload vectors if the period has no such reasons,
+// eg: the whole range is one period, or the period is between two annotation boundaries
+func (a *AutoPerfAssistant) periodWorkload(period base.Period) (desc base.WorkloadDesc, ok bool) {
+	if desc, ok = period.Workload(); ok {
+		return
+	}
+	return base.WorkloadDescInRange(a.workload, period.Start, period.End)
+}
+
+// Report the failed steps of a partial result, return the error if it's not partial
+func (a *AutoPerfAssistant) checkPartial(err error, indent string) error {
+	if err == nil {
+		return nil
+	}
+	var partial *base.PartialError
+	if !errors.As(err, &partial) {
+		return err
+	}
+	for _, it := range partial.Errors {
+		a.con.Compact(indent, "!! failed: ", it, "\n")
+	}
+	return nil
+}
+
+// The transitions are not counted
+func countFullPeriods(periods []base.Period) (count int) {
+	for _, period := range periods {
+		if !period.Transition {
+			count += 1
+		}
+	}
 	return
 }
 
 func (a *AutoPerfAssistant) removePeriods(origin []base.Period) (periods []base.Period, err error) {
-	if a.periodCount > 0 && len(origin) > a.periodCount {
-		a.con.Debug("## too many periods, reducing: ", len(origin), " => ")
-		origin = origin[len(origin)-a.periodCount:]
-		a.con.Debug(len(origin), "\n")
+	if flatten := base.FlattenPeriods(origin, a.periodLevel); a.periodCount > 0 && countFullPeriods(flatten) > a.periodCount {
+		a.con.Debug("## too many periods in level ", a.periodLevel, ", reducing: ", len(flatten), " => ")
+		i := len(flatten)
+		for count := 0; i > 0 && count < a.periodCount; {
+			i -= 1
+			if !flatten[i].Transition {
+				count += 1
+			}
+		}
+		origin = base.TrimPeriods(origin, flatten[i].Start)
+		a.con.Debug(len(flatten)-i, "\n")
 	} else if !a.timeRange.Valid() {
 		if len(origin) > 1 {
 			a.con.Debug("## removing the first period, it's imcompleted\n")
@@ -134,45 +332,16 @@ func (a *AutoPerfAssistant) removePeriods(origin []base.Period) (periods []base.
 }
 
 func (a *AutoPerfAssistant) DoDectect(detector detectors.Detectors) (err error) {
-	periods, err := a.DetectPeriods()
+	if a.output == "text" {
+		return a.outputText(&detector)
+	}
+	report, err := a.Analyze(&detector)
 	if err != nil {
 		return
 	}
-
-	workload := detector.GetWorkload()
-	for _, w := range workload {
-		a.con.Debug("## args: workload ", w, "\n")
-	}
-
-	for _, period := range periods {
-		a.con.Detail("[", period.Start.Format(base.TimeFormat), " => ", period.End.Format(base.TimeFormat), "]", "\n")
-		whyStart := fmt.Sprintf("%v", period.StartReason)
-		if whyStart != "start" {
-			whyStartReason := period.StartReason.(base.WorkloadBreakingReason)
-			a.con.Debug("    ## ", whyStartReason.Similarity, "\n")
-			a.con.Debug("    ## prev workload ", whyStartReason.PrevWorkload.RawString(), "\n")
-			a.con.Debug("    ## curr workload ", whyStartReason.CurrWorkload.RawString(), "\n")
-			a.con.Detail("    ** ", whyStartReason.CurrWorkload, "\n")
-		}
-
-		var events detectors.Events
-		events, err = detector.RunWorkload(a.data, period, a.con)
-		if err != nil {
-			return
-		}
-		for _, event := range events {
-			event.What.Output(event.When, a.con, "    ")
-		}
-
-		whyEnd := fmt.Sprintf("%v", period.EndReason)
-		lasted := period.End.Sub(period.Start).Truncate(time.Minute)
-		if whyEnd != "end" {
-			whyEndReason := period.EndReason.(base.WorkloadBreakingReason)
-			a.con.Debug("    ## ", whyEndReason.Similarity, "\n")
-			a.con.Debug("    ## curr workload ", whyEndReason.PrevWorkload.RawString(), "\n")
-			a.con.Debug("    ## next workload ", whyEndReason.CurrWorkload.RawString(), "\n")
-		}
-		a.con.Detail("    ** lasted ", lasted, "\n")
+	if a.output == "json" {
+		return a.outputJSON(report)
 	}
+	a.outputMarkdown(report)
 	return
 }
@@ -2,6 +2,9 @@ package base
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -45,16 +48,26 @@ func (b BreakingPoints) Less(i, j int) bool {
 	return b[i].Point < b[j].Point
 }
 
-func FindBreakingPoints(vector CollectedSourceTasks) (points []BreakingPoint) {
-	eq := GetBreakingFunc(vector.Source.Function)
+// A change is a breaking point only if the new value holds for the breaking's hold duration
+func FindBreakingPoints(vector CollectedSourceTasks) (points []BreakingPoint, err error) {
+	breaking, err := ParseBreaking(vector.Source.Function)
+	if err != nil {
+		return
+	}
+	if breaking.Group {
+		err = fmt.Errorf("breaking function %s should be used on vector groups", breaking.Name)
+		return
+	}
 	var prev model.SamplePair
 	for i, pair := range vector.Pairs {
 		if i == 0 {
 			prev = pair
 			continue
 		}
-		sameValue := eq(pair.Value, prev.Value)
-		if sameValue {
+		if breaking.Same(pair.Value, prev.Value) {
+			continue
+		}
+		if !breaking.Held(vector.Pairs[i:]) {
 			continue
 		}
 		points = append(points, BreakingPoint{pair.Timestamp, prev, pair, vector.Metric})
@@ -63,19 +76,194 @@ func FindBreakingPoints(vector CollectedSourceTasks) (points []BreakingPoint) {
 	return
 }
 
+// Judge if two values are the same
 type BreakingFunc func(a model.SampleValue, b model.SampleValue) bool
 
+// Parsed from the function of a source task, format: 'name' or 'name:arg,arg'
+type Breaking struct {
+	Name string
+	Same BreakingFunc
+
+	// A change counts only if the new value holds at least this long
+	Hold time.Duration
+
+	// Judged on vector groups by similarity, instead of value pairs
+	Group     bool
+	Threshold float64
+}
+
+func (b Breaking) Held(pairs []model.SamplePair) bool {
+	if b.Hold == 0 {
+		return true
+	}
+	start := Ms2Time(pairs[0].Timestamp)
+	for _, pair := range pairs[1:] {
+		if !b.Same(pair.Value, pairs[0].Value) {
+			return false
+		}
+		if Ms2Time(pair.Timestamp).Sub(start) >= b.Hold {
+			return true
+		}
+	}
+	return false
+}
+
+type BreakingBuilder func(args []string) (Breaking, error)
+
+var breakingBuilders = map[string]BreakingBuilder{
+	"eq":        buildPreciseEq,
+	"abs":       buildAbsEq,
+	"rel":       buildRelEq,
+	"pct":       buildPercentEq,
+	"threshold": buildThreshold,
+	"step":      buildStep,
+	"cosine":    buildCosine,
+}
+
+func ParseBreaking(function string) (breaking Breaking, err error) {
+	name := function
+	var args []string
+	if i := strings.Index(function, ":"); i >= 0 {
+		name = function[:i]
+		args = strings.Split(function[i+1:], ",")
+	}
+	builder, ok := breakingBuilders[name]
+	if !ok {
+		err = fmt.Errorf("unknown breaking function: '%s'", function)
+		return
+	}
+	breaking, err = builder(args)
+	if err != nil {
+		err = fmt.Errorf("breaking function '%s': %v", function, err)
+		return
+	}
+	breaking.Name = name
+	return
+}
+
+// The similarity threshold of the group breaking function of the sources, eg: 'cosine:0.7'
+func ParseGroupBreakingThreshold(sources []SourceTask) (threshold float64, err error) {
+	if len(sources) == 0 {
+		err = fmt.Errorf("no sources to get the breaking function")
+		return
+	}
+	breaking, err := ParseBreaking(sources[0].Function)
+	if err != nil {
+		return
+	}
+	if !breaking.Group {
+		err = fmt.Errorf("breaking function %s should be used on vector groups", breaking.Name)
+		return
+	}
+	return breaking.Threshold, nil
+}
+
 func PreciseEq(a model.SampleValue, b model.SampleValue) bool {
-	// TODO: float cmp
-	return a == b
+	return a == b || math.IsNaN(float64(a)) && math.IsNaN(float64(b))
+}
+
+func buildPreciseEq(args []string) (breaking Breaking, err error) {
+	if len(args) != 0 {
+		err = fmt.Errorf("no args needed")
+		return
+	}
+	breaking.Same = PreciseEq
+	return
+}
+
+// abs:epsilon
+func buildAbsEq(args []string) (breaking Breaking, err error) {
+	epsilon, err := parseBreakingArg(args)
+	if err != nil {
+		return
+	}
+	breaking.Same = func(a model.SampleValue, b model.SampleValue) bool {
+		return PreciseEq(a, b) || math.Abs(float64(a-b)) <= epsilon
+	}
+	return
+}
+
+// rel:epsilon, relative to the larger one
+func buildRelEq(args []string) (breaking Breaking, err error) {
+	epsilon, err := parseBreakingArg(args)
+	if err != nil {
+		return
+	}
+	breaking.Same = func(a model.SampleValue, b model.SampleValue) bool {
+		max := math.Max(math.Abs(float64(a)), math.Abs(float64(b)))
+		return PreciseEq(a, b) || math.Abs(float64(a-b)) <= epsilon*max
+	}
+	return
 }
 
-func GetBreakingFunc(name string) BreakingFunc {
-	switch name {
-	case "eq":
-		return PreciseEq
+// pct:percent, relative to the previous value
+func buildPercentEq(args []string) (breaking Breaking, err error) {
+	percent, err := parseBreakingArg(args)
+	if err != nil {
+		return
+	}
+	breaking.Same = func(curr model.SampleValue, prev model.SampleValue) bool {
+		if PreciseEq(curr, prev) {
+			return true
+		}
+		if prev == 0 {
+			return false
+		}
+		return math.Abs(float64(curr-prev)/float64(prev))*100 <= percent
+	}
+	return
+}
+
+// threshold:value, the same if both values are on the same side
+func buildThreshold(args []string) (breaking Breaking, err error) {
+	threshold, err := parseBreakingArg(args)
+	if err != nil {
+		return
+	}
+	breaking.Same = func(a model.SampleValue, b model.SampleValue) bool {
+		return (float64(a) > threshold) == (float64(b) > threshold)
 	}
-	panic("no function: " + name)
+	return
+}
+
+// step:epsilon,hold, an absolute change larger than epsilon and holds at least the duration
+func buildStep(args []string) (breaking Breaking, err error) {
+	if len(args) != 2 {
+		err = fmt.Errorf("should have 2 args: epsilon,hold")
+		return
+	}
+	breaking, err = buildAbsEq(args[:1])
+	if err != nil {
+		return
+	}
+	breaking.Hold, err = time.ParseDuration(args[1])
+	return
+}
+
+// cosine or cosine:threshold, the default threshold is WorkloadPeriodThreshold
+func buildCosine(args []string) (breaking Breaking, err error) {
+	breaking.Group = true
+	breaking.Threshold = WorkloadPeriodThreshold
+	if len(args) != 0 {
+		breaking.Threshold, err = parseBreakingArg(args)
+	}
+	if err == nil && (breaking.Threshold <= 0 || breaking.Threshold > 1) {
+		err = fmt.Errorf("threshold should be in (0, 1], got: %v", breaking.Threshold)
+	}
+	return
+}
+
+// Exactly one non-negative number
+func parseBreakingArg(args []string) (value float64, err error) {
+	if len(args) != 1 {
+		err = fmt.Errorf("should have 1 arg, got %d", len(args))
+		return
+	}
+	value, err = strconv.ParseFloat(args[0], 64)
+	if err == nil && value < 0 {
+		err = fmt.Errorf("arg should not be negative: %v", value)
+	}
+	return
 }
 
 type SimilarityBreakingReason struct {
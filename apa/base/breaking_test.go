@@ -0,0 +1,156 @@
+package base
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestParseBreakingErrors(t *testing.T) {
+	cases := []struct {
+		function string
+		err      string
+	}{
+		{"unknown", "unknown breaking function"},
+		{"eq:1", "no args needed"},
+		{"abs", "should have 1 arg"},
+		{"abs:1,2", "should have 1 arg"},
+		{"abs:x", "invalid syntax"},
+		{"abs:-1", "should not be negative"},
+		{"rel", "should have 1 arg"},
+		{"rel:-0.1", "should not be negative"},
+		{"pct:", "invalid syntax"},
+		{"pct:-10", "should not be negative"},
+		{"threshold", "should have 1 arg"},
+		{"threshold:1,2", "should have 1 arg"},
+		{"step:10", "should have 2 args"},
+		{"step:-10,5m", "should not be negative"},
+		{"step:10,5", "missing unit"},
+		{"cosine:x", "invalid syntax"},
+		{"cosine:0.5,0.6", "should have 1 arg"},
+		{"cosine:0", "should be in (0, 1]"},
+		{"cosine:1.5", "should be in (0, 1]"},
+	}
+	for _, c := range cases {
+		_, err := ParseBreaking(c.function)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error '%s', got: %v", c.function, c.err, err)
+		}
+	}
+}
+
+func TestParseBreakingSame(t *testing.T) {
+	nan := model.SampleValue(math.NaN())
+	cases := []struct {
+		function string
+		a        model.SampleValue
+		b        model.SampleValue
+		same     bool
+	}{
+		{"eq", 1, 1, true},
+		{"eq", 1, 1.001, false},
+		{"eq", nan, nan, true},
+		{"eq", nan, 1, false},
+		{"abs:0.5", 1, 1.5, true},
+		{"abs:0.5", 1, 1.6, false},
+		{"abs:0", nan, nan, true},
+		{"rel:0.1", 100, 91, true},
+		{"rel:0.1", 100, 89, false},
+		{"rel:0.1", -100, -91, true},
+		{"pct:10", 110, 100, true},
+		{"pct:10", 111, 100, false},
+		{"pct:10", 90, 100, true},
+		{"pct:10", 1, 0, false},
+		{"pct:10", 0, 0, true},
+		{"threshold:100", 99, 50, true},
+		{"threshold:100", 101, 200, true},
+		{"threshold:100", 100, 101, false},
+		{"threshold:100", 101, 99, false},
+		{"step:10,5m", 10, 20, true},
+		{"step:10,5m", 10, 21, false},
+	}
+	for _, c := range cases {
+		breaking, err := ParseBreaking(c.function)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.function, err)
+			continue
+		}
+		if breaking.Same(c.a, c.b) != c.same {
+			t.Errorf("%s: expected %v and %v same %v", c.function, c.a, c.b, c.same)
+		}
+	}
+
+	breaking, err := ParseBreaking("cosine")
+	if err != nil || !breaking.Group || breaking.Threshold != WorkloadPeriodThreshold {
+		t.Errorf("cosine: expected a group breaking with the default threshold, got %v %v", breaking, err)
+	}
+	breaking, err = ParseBreaking("cosine:0.6")
+	if err != nil || breaking.Threshold != 0.6 {
+		t.Errorf("cosine:0.6: expected threshold 0.6, got %v %v", breaking.Threshold, err)
+	}
+}
+
+func TestBreakingHeld(t *testing.T) {
+	pairs := func(values ...float64) (pairs []model.SamplePair) {
+		for i, value := range values {
+			pairs = append(pairs, model.SamplePair{
+				Timestamp: model.Time(int64(i) * int64(time.Minute/time.Millisecond)),
+				Value:     model.SampleValue(value),
+			})
+		}
+		return
+	}
+	cases := []struct {
+		function string
+		pairs    []model.SamplePair
+		held     bool
+	}{
+		{"abs:1", pairs(10), true},
+		{"step:1,3m", pairs(10, 10, 10, 11), true},
+		{"step:1,3m", pairs(10, 10, 10, 12), false},
+		{"step:1,3m", pairs(10, 10, 10), false},
+		{"step:1,3m", pairs(10, 11, 9, 10, 10), true},
+		{"step:1,3m", pairs(10, 11, 12, 10), false},
+	}
+	for _, c := range cases {
+		breaking, err := ParseBreaking(c.function)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.function, err)
+			continue
+		}
+		if breaking.Held(c.pairs) != c.held {
+			t.Errorf("%s: expected %v held %v", c.function, c.pairs, c.held)
+		}
+	}
+}
+
+func TestParseGroupBreakingThreshold(t *testing.T) {
+	cases := []struct {
+		function  string
+		threshold float64
+		err       string
+	}{
+		{"cosine", WorkloadPeriodThreshold, ""},
+		{"cosine:0.7", 0.7, ""},
+		{"abs:1", 0, "should be used on vector groups"},
+		{"unknown", 0, "unknown breaking function"},
+	}
+	for _, c := range cases {
+		threshold, err := ParseGroupBreakingThreshold([]SourceTask{{"prometheus", "", c.function}})
+		if len(c.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error '%s', got: %v", c.function, c.err, err)
+			}
+			continue
+		}
+		if err != nil || threshold != c.threshold {
+			t.Errorf("%s: expected threshold %v, got %v %v", c.function, c.threshold, threshold, err)
+		}
+	}
+	if _, err := ParseGroupBreakingThreshold(nil); err == nil {
+		t.Errorf("expected error without sources")
+	}
+}
@@ -3,23 +3,34 @@ package base
 import (
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/prometheus/common/model"
 )
 
-func CalculateSimilarities(vectors []CollectedSourceTasks) (similarities []float64, aligned []CollectedSourceTasks, times []time.Time) {
-	vectors = AlignVectorsLength(vectors)
-	if len(vectors[0].Pairs) == 0 {
+// The similarities across scrape gaps are 1, so no workload changes are invented at gaps
+func CalculateSimilarities(vectors []CollectedSourceTasks) (similarities []float64, aligned []CollectedSourceTasks,
+	times []time.Time, gaps []Gap, err error) {
+
+	vectors, gaps = AlignVectorsByTime(vectors)
+	if len(vectors) == 0 || len(vectors[0].Pairs) == 0 {
+		return
+	}
+	vecs, timestamps, err := RotateToPeriodVecs(vectors)
+	if err != nil {
 		return
 	}
-	vecs, timestamps := RotateToPeriodVecs(vectors)
 	times = make([]time.Time, len(timestamps))
 	for i, it := range timestamps {
 		times[i] = Ms2Time(it)
 	}
 	similarities = []float64{1}
 	for i := 1; i < len(vecs); i++ {
+		if isGapEnd(gaps, times[i]) {
+			similarities = append(similarities, 1)
+			continue
+		}
 		//similarity := DistanceSimilarity(vecs[i-1], vecs[i])
 		similarity := CosineSimilarity(vecs[i-1], vecs[i])
 		if math.IsNaN(similarity) {
@@ -31,7 +42,7 @@ func CalculateSimilarities(vectors []CollectedSourceTasks) (similarities []float
 			} else if z1 || z2 {
 				similarity = 0.5
 			} else {
-				panic(fmt.Sprintf("similarity is NaN: %v vs %v", vecs[i-1], vecs[i]))
+				return nil, nil, nil, nil, NaNSimilarityError{times[i], vecs[i-1], vecs[i]}
 			}
 		}
 		similarities = append(similarities, similarity)
@@ -51,28 +62,120 @@ func (p PeriodVec) Sum() float64 {
 	return sum
 }
 
-func AlignVectorsLength(origin []CollectedSourceTasks) (vectors []CollectedSourceTasks) {
+// A time range that none of the vectors has samples
+type Gap struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("%s => %s", g.Start.Format(TimeFormat), g.End.Format(TimeFormat))
+}
+
+func isGapEnd(gaps []Gap, t time.Time) bool {
+	for _, gap := range gaps {
+		if gap.End.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Align the vectors on the grid of all their timestamps.
+// A missing sample is interpolated if it's in a short hole of the vector, otherwise filled with zero,
+//   eg: a gRPC type starts in the middle of the range.
+// The intervals much longer than the step are scrape gaps, the step is the min interval of the grid.
+func AlignVectorsByTime(origin []CollectedSourceTasks) (vectors []CollectedSourceTasks, gaps []Gap) {
 	if len(origin) == 0 {
 		return
 	}
-	minLen := INT_MAX
+
+	timestamps := make(map[model.Time]bool)
 	for _, it := range origin {
-		if minLen > len(it.Pairs) {
-			minLen = len(it.Pairs)
+		for _, pair := range it.Pairs {
+			timestamps[pair.Timestamp] = true
+		}
+	}
+	grid := make([]model.Time, 0, len(timestamps))
+	for t, _ := range timestamps {
+		grid = append(grid, t)
+	}
+	sort.Slice(grid, func(i, j int) bool {
+		return grid[i] < grid[j]
+	})
+
+	step := GridStep(grid)
+	for i := 1; i < len(grid); i++ {
+		if float64(grid[i]-grid[i-1]) > float64(step)*AlignGapStepRatio {
+			gaps = append(gaps, Gap{Ms2Time(grid[i-1]), Ms2Time(grid[i])})
 		}
 	}
 
 	for _, it := range origin {
-		if len(it.Pairs) > minLen {
-			it.Pairs = it.Pairs[0:minLen]
-			// TODO: need more info merging here?
+		values := make(map[model.Time]model.SampleValue)
+		for _, pair := range it.Pairs {
+			if !math.IsNaN(float64(pair.Value)) {
+				values[pair.Timestamp] = pair.Value
+			}
+		}
+		pairs := make([]model.SamplePair, len(grid))
+		for i, t := range grid {
+			pairs[i] = model.SamplePair{Timestamp: t, Value: alignedValue(values, grid, i, step)}
 		}
+		it.Pairs = pairs
 		vectors = append(vectors, it)
 	}
-	return vectors
+	return
+}
+
+// The min interval of the grid, return 0 if less than two points
+func GridStep(grid []model.Time) (step model.Time) {
+	for i := 1; i < len(grid); i++ {
+		interval := grid[i] - grid[i-1]
+		if interval > 0 && (step == 0 || interval < step) {
+			step = interval
+		}
+	}
+	return
+}
+
+func alignedValue(values map[model.Time]model.SampleValue, grid []model.Time, i int, step model.Time) model.SampleValue {
+	if value, ok := values[grid[i]]; ok {
+		return value
+	}
+
+	prev := -1
+	for j := i - 1; j >= 0 && j >= i-AlignMaxInterpolateSamples; j-- {
+		if _, ok := values[grid[j]]; ok {
+			prev = j
+			break
+		}
+	}
+	next := -1
+	for j := i + 1; j < len(grid) && j <= i+AlignMaxInterpolateSamples; j++ {
+		if _, ok := values[grid[j]]; ok {
+			next = j
+			break
+		}
+	}
+	if prev < 0 || next < 0 || next-prev > AlignMaxInterpolateSamples+1 {
+		return 0
+	}
+
+	// Not interpolating across scrape gaps
+	if float64(grid[next]-grid[prev]) > float64(step)*AlignGapStepRatio*float64(next-prev) {
+		return 0
+	}
+
+	ratio := float64(grid[i]-grid[prev]) / float64(grid[next]-grid[prev])
+	return values[grid[prev]] + model.SampleValue(ratio)*(values[grid[next]]-values[grid[prev]])
 }
 
-func RotateToPeriodVecs(vectors []CollectedSourceTasks) (vecs []PeriodVec, times []model.Time) {
+func RotateToPeriodVecs(vectors []CollectedSourceTasks) (vecs []PeriodVec, times []model.Time, err error) {
 	if len(vectors) == 0 {
 		return
 	}
@@ -85,8 +188,7 @@ func RotateToPeriodVecs(vectors []CollectedSourceTasks) (vecs []PeriodVec, times
 				t = it.Pairs[i].Timestamp
 			} else {
 				if t != it.Pairs[i].Timestamp {
-					line := fmt.Sprintf("%s vs %s", Ms2Time(t).Format(TimeFormat), Ms2Time(it.Pairs[i].Timestamp).Format(TimeFormat))
-					panic("timestamps not matched in multiply vectors from one query: " + line)
+					return nil, nil, TimestampMismatchError{i, Ms2Time(t), Ms2Time(it.Pairs[i].Timestamp)}
 				}
 			}
 			vec = append(vec, float64(it.Pairs[i].Value))
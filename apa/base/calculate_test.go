@@ -0,0 +1,127 @@
+package base
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// The samples are keyed by minutes
+func minuteVector(name string, samples map[int]float64) CollectedSourceTasks {
+	vector := CollectedSourceTasks{Metric: model.Metric{"type": model.LabelValue(name)}}
+	for minute := 0; minute <= 60; minute++ {
+		if value, ok := samples[minute]; ok {
+			vector.Pairs = append(vector.Pairs, model.SamplePair{
+				Timestamp: model.Time(int64(minute) * int64(time.Minute/time.Millisecond)),
+				Value:     model.SampleValue(value),
+			})
+		}
+	}
+	return vector
+}
+
+func minuteTime(minute int) time.Time {
+	return Ms2Time(model.Time(int64(minute) * int64(time.Minute/time.Millisecond)))
+}
+
+func TestAlignVectorsByTime(t *testing.T) {
+	full := minuteVector("full", map[int]float64{0: 1, 1: 1, 2: 1, 3: 1, 4: 1, 5: 1, 6: 1})
+	cases := []struct {
+		name     string
+		origin   []CollectedSourceTasks
+		expected [][]float64
+		gaps     []Gap
+	}{
+		{"aligned", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 1, 1: 2, 2: 3}),
+			minuteVector("b", map[int]float64{0: 4, 1: 5, 2: 6}),
+		}, [][]float64{{1, 2, 3}, {4, 5, 6}}, nil},
+		{"one missing sample", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 2, 1: 4, 3: 8, 4: 10, 5: 12, 6: 14}), full,
+		}, [][]float64{{2, 4, 6, 8, 10, 12, 14}, {1, 1, 1, 1, 1, 1, 1}}, nil},
+		{"missing samples at the limit", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 0, 1: 4, 5: 20, 6: 24}), full,
+		}, [][]float64{{0, 4, 8, 12, 16, 20, 24}, {1, 1, 1, 1, 1, 1, 1}}, nil},
+		{"missing samples over the limit", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 4, 6: 4}), full,
+		}, [][]float64{{4, 0, 0, 0, 0, 0, 4}, {1, 1, 1, 1, 1, 1, 1}}, nil},
+		{"started late", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{2: 3, 3: 3, 4: 3, 5: 3, 6: 3}), full,
+		}, [][]float64{{0, 0, 3, 3, 3, 3, 3}, {1, 1, 1, 1, 1, 1, 1}}, nil},
+		{"gap of all vectors", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 1, 1: 2, 5: 3, 6: 4}),
+			minuteVector("b", map[int]float64{0: 5, 1: 6, 5: 7, 6: 8}),
+		}, [][]float64{{1, 2, 3, 4}, {5, 6, 7, 8}}, []Gap{{minuteTime(1), minuteTime(5)}}},
+		{"no interpolating across a gap", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 1, 1: 2, 6: 4}),
+			minuteVector("b", map[int]float64{0: 5, 1: 6, 5: 7, 6: 8}),
+		}, [][]float64{{1, 2, 0, 4}, {5, 6, 7, 8}}, []Gap{{minuteTime(1), minuteTime(5)}}},
+		{"one vector missing is not a gap", []CollectedSourceTasks{
+			minuteVector("a", map[int]float64{0: 1, 1: 1}), full,
+		}, [][]float64{{1, 1, 0, 0, 0, 0, 0}, {1, 1, 1, 1, 1, 1, 1}}, nil},
+	}
+
+	for _, c := range cases {
+		vectors, gaps := AlignVectorsByTime(c.origin)
+		if len(vectors) != len(c.expected) {
+			t.Errorf("%s: expected %d vectors, got %d", c.name, len(c.expected), len(vectors))
+			continue
+		}
+		for i, vector := range vectors {
+			var values []float64
+			for _, pair := range vector.Pairs {
+				values = append(values, float64(pair.Value))
+			}
+			if !floatsEqual(values, c.expected[i]) {
+				t.Errorf("%s: vector %d expected %v, got %v", c.name, i, c.expected[i], values)
+			}
+			if vector.Metric["type"] != c.origin[i].Metric["type"] {
+				t.Errorf("%s: vector %d lost its metric", c.name, i)
+			}
+		}
+		if len(gaps) != len(c.gaps) {
+			t.Errorf("%s: expected gaps %v, got %v", c.name, c.gaps, gaps)
+			continue
+		}
+		for i, gap := range gaps {
+			if !gap.Start.Equal(c.gaps[i].Start) || !gap.End.Equal(c.gaps[i].End) {
+				t.Errorf("%s: expected gaps %v, got %v", c.name, c.gaps, gaps)
+				break
+			}
+		}
+	}
+}
+
+func TestCalculateSimilaritiesAtGapEnd(t *testing.T) {
+	vectors := []CollectedSourceTasks{
+		minuteVector("a", map[int]float64{0: 10, 1: 0, 5: 10, 6: 10}),
+		minuteVector("b", map[int]float64{0: 0, 1: 10, 5: 0, 6: 0}),
+	}
+	similarities, aligned, times, gaps, err := CalculateSimilarities(vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !floatsEqual(similarities, []float64{1, 0, 1, 1}) {
+		t.Errorf("expected similarities [1 0 1 1], the one at the gap end forced to 1, got %v", similarities)
+	}
+	if len(aligned) != 2 || len(times) != 4 || !times[2].Equal(minuteTime(5)) {
+		t.Errorf("unexpected aligned vectors %v at %v", aligned, times)
+	}
+	if len(gaps) != 1 || !gaps[0].Start.Equal(minuteTime(1)) || !gaps[0].End.Equal(minuteTime(5)) {
+		t.Errorf("expected the gap from minute 1 to 5, got %v", gaps)
+	}
+}
+
+func floatsEqual(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
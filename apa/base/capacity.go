@@ -0,0 +1,117 @@
+package base
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The throughput and the latency of one period
+type CapacitySample struct {
+	Period  Period
+	Qps     float64
+	Latency time.Duration
+}
+
+type CapacitySamples []CapacitySample
+
+func (c CapacitySamples) Len() int {
+	return len(c)
+}
+
+func (c CapacitySamples) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c CapacitySamples) Less(i, j int) bool {
+	return c[i].Qps < c[j].Qps
+}
+
+// The saturation knee is the throughput where the latency reaches the threshold,
+// if all samples exceed the threshold the knee is not found and is below the lowest qps
+type CapacityKnee struct {
+	Class        string
+	Threshold    time.Duration
+	Qps          float64
+	Found        bool
+	Extrapolated bool
+	Exceeded     bool
+	Samples      CapacitySamples
+}
+
+func (c CapacityKnee) String() string {
+	if c.Exceeded {
+		return fmt.Sprintf("%s: p%v exceeds %v in all %d period(s), knee below ~%.0f qps",
+			c.Class, CapacityLatencyQuantile*100, c.Threshold, len(c.Samples), c.Qps)
+	}
+	if !c.Found {
+		return fmt.Sprintf("%s: knee unknown, latency not rising with qps in %d period(s)", c.Class, len(c.Samples))
+	}
+	desc := fmt.Sprintf("%s: sustains ~%.0f qps before p%v exceeds %v",
+		c.Class, c.Qps, CapacityLatencyQuantile*100, c.Threshold)
+	if c.Extrapolated {
+		desc += " (extrapolated)"
+	}
+	return desc
+}
+
+// Return the percentage of the knee the sample ran to, return 0 if the knee is not found
+func (c CapacityKnee) Usage(sample CapacitySample) float64 {
+	if !c.Found || c.Qps <= 0 {
+		return 0
+	}
+	return sample.Qps / c.Qps * 100
+}
+
+// Interpolate between the samples around the threshold, or fit a line and extrapolate if none of them reached it.
+// A sample exceeding the threshold counts only if all the samples with higher qps exceed it too,
+// so a latency spike at a low qps is taken as noise but not as the knee
+func EstimateCapacityKnee(class string, samples CapacitySamples, threshold time.Duration) (knee CapacityKnee) {
+	knee = CapacityKnee{Class: class, Threshold: threshold, Samples: samples}
+	sort.Sort(samples)
+
+	exceeded := len(samples)
+	for exceeded > 0 && samples[exceeded-1].Latency >= threshold {
+		exceeded -= 1
+	}
+	if exceeded == 0 && len(samples) != 0 {
+		knee.Qps = samples[0].Qps
+		knee.Exceeded = true
+		return
+	}
+	if exceeded < len(samples) {
+		prev := samples[exceeded-1]
+		sample := samples[exceeded]
+		ratio := float64(threshold-prev.Latency) / float64(sample.Latency-prev.Latency)
+		knee.Qps = prev.Qps + (sample.Qps-prev.Qps)*ratio
+		knee.Found = true
+		return
+	}
+
+	if len(samples) < 2 {
+		return
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.Qps
+		y := sample.Latency.Seconds()
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope <= 0 {
+		return
+	}
+	intercept := (sumY - slope*sumX) / n
+	knee.Qps = (threshold.Seconds() - intercept) / slope
+	knee.Found = knee.Qps > 0
+	knee.Extrapolated = true
+	return
+}
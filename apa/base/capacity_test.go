@@ -0,0 +1,59 @@
+package base
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateCapacityKnee(t *testing.T) {
+	ms := time.Millisecond
+	sample := func(qps float64, latency time.Duration) CapacitySample {
+		return CapacitySample{Qps: qps, Latency: latency}
+	}
+
+	cases := []struct {
+		name         string
+		samples      CapacitySamples
+		qps          float64
+		found        bool
+		extrapolated bool
+		exceeded     bool
+	}{
+		{"no samples", nil, 0, false, false, false},
+		{"interpolated", CapacitySamples{sample(1000, 20*ms), sample(3000, 150*ms), sample(2000, 50*ms)},
+			2500, true, false, false},
+		{"reached exactly", CapacitySamples{sample(1000, 20*ms), sample(2000, 100*ms)},
+			2000, true, false, false},
+		{"extrapolated", CapacitySamples{sample(1000, 20*ms), sample(2000, 40*ms), sample(3000, 60*ms)},
+			5000, true, true, false},
+		{"latency not rising", CapacitySamples{sample(1000, 40*ms), sample(2000, 30*ms)},
+			0, false, false, false},
+		{"single sample under threshold", CapacitySamples{sample(1000, 20*ms)},
+			0, false, false, false},
+		{"spike at low qps", CapacitySamples{sample(500, 300*ms), sample(1000, 20*ms), sample(2000, 180*ms)},
+			1500, true, false, false},
+		{"spike in the middle", CapacitySamples{sample(1000, 20*ms), sample(2000, 150*ms), sample(3000, 60*ms),
+			sample(4000, 140*ms)}, 3500, true, false, false},
+		{"all exceeded", CapacitySamples{sample(2000, 200*ms), sample(1000, 150*ms)},
+			1000, false, false, true},
+	}
+
+	for _, c := range cases {
+		knee := EstimateCapacityKnee("class", c.samples, 100*ms)
+		if knee.Found != c.found || knee.Extrapolated != c.extrapolated || knee.Exceeded != c.exceeded {
+			t.Errorf("%s: expected found %v extrapolated %v exceeded %v, got %v %v %v", c.name,
+				c.found, c.extrapolated, c.exceeded, knee.Found, knee.Extrapolated, knee.Exceeded)
+			continue
+		}
+		if math.Abs(knee.Qps-c.qps) > 1e-6 {
+			t.Errorf("%s: expected knee %v, got %v", c.name, c.qps, knee.Qps)
+		}
+		for i := 1; i < len(knee.Samples); i++ {
+			if knee.Samples[i-1].Qps > knee.Samples[i].Qps {
+				t.Errorf("%s: samples not sorted by qps: %v", c.name, knee.Samples)
+				break
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package base
 // The content in this file should be put into config file
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -16,8 +17,120 @@ const (
 	QpsThresholdActive      = 2.0
 	QpsThresholdAlot        = 500.0
 	QpsThresholdHeavy       = 2000.0
+
+	// TiKV default values of rocksdb write stall triggers
+	WriteStallL0FilesSlowdown      = 20.0
+	WriteStallPendingBytesSlowdown = 64.0 * 1024 * 1024 * 1024
+	WriteStallMemtablesSlowdown    = 5.0
+	WriteStallMinDuration          = 30 * time.Second
+	WriteStallDurationMajor        = 5 * time.Minute
+	WriteStallMaxCritical          = float64(time.Second / time.Microsecond)
+
+	ThreadPoolSaturatedRatio       = 0.9
+	ThreadPoolSaturatedMinDuration = 5 * time.Minute
+
+	ContentionMinDuration = 2 * time.Minute
+
+	HotStoreFlowRatio   = 2.0
+	HotStoreMinDuration = 10 * time.Minute
+
+	// Operators per second
+	SchedulingStormMinRate     = 0.5
+	SchedulingStormRatio       = 5.0
+	SchedulingStormMinDuration = time.Minute
+	SchedulingStormLookback    = time.Hour
+	// The p99 latency around a storm compares to the median p99 out of it
+	SchedulingStormLatencyRatio = 1.5
+
+	CapacityLatencyQuantile = 0.99
+
+	HistoryLatencyQuantile = 0.99
+
+	CorrelationSlack    = 5 * time.Minute
+	CorrelationMaxShown = 3
+
+	AlignGapStepRatio          = 1.5
+	AlignMaxInterpolateSamples = 3
+
+	SeasonalDailyMaxCycles  = 7
+	SeasonalWeeklyMaxCycles = 4
+	SeasonalVolumeTolerance = 1.5
+
+	FingerprintMatchThreshold = 0.9
+
+	MinPeriodDuration = 5 * time.Minute
 )
 
+// The pool size is the count of threads matched the name pattern
+type ThreadPool struct {
+	Name          string
+	ThreadPattern string
+}
+
+var TiKVThreadPools = []ThreadPool{
+	ThreadPool{"raftstore", "raftstore_.*"},
+	ThreadPool{"apply", "apply_.*"},
+	ThreadPool{"scheduler", "sched_worker.*"},
+	ThreadPool{"grpc", "grpc_server_.*"},
+	ThreadPool{"unified-read-pool", "unified_read_po.*"},
+}
+
+// A contention signal is elevated when it's above the threshold
+type ContentionSignal struct {
+	Name      string
+	Desc      string
+	Unit      string
+	Query     string
+	Threshold float64
+}
+
+var TiDBContentionSignals = []ContentionSignal{
+	ContentionSignal{
+		"txn_retry", "txn retries", "/s",
+		"sum(rate(tidb_session_retry_num_count[1m]))",
+		1,
+	},
+	ContentionSignal{
+		"write_conflict", "write conflicts", "/s",
+		"sum(rate(tikv_storage_mvcc_conflict_counter{type=\"prewrite_write_conflict\"}[1m]))",
+		1,
+	},
+	ContentionSignal{
+		"lock_wait", "avg pessimistic lock wait", "s",
+		"sum(rate(tikv_lock_manager_waiter_lifetime_duration_sum[1m])) / sum(rate(tikv_lock_manager_waiter_lifetime_duration_count[1m]))",
+		0.1,
+	},
+	ContentionSignal{
+		"deadlock", "deadlocks", "/s",
+		"sum(rate(tikv_lock_manager_error_counter{type=\"deadlock\"}[1m]))",
+		0.01,
+	},
+	ContentionSignal{
+		"check_txn_status", "kv_check_txn_status", "/s",
+		"sum(rate(tikv_grpc_msg_duration_seconds_count{type=\"kv_check_txn_status\"}[1m]))",
+		10,
+	},
+	ContentionSignal{
+		"resolve_lock", "kv_resolve_lock", "/s",
+		"sum(rate(tikv_grpc_msg_duration_seconds_count{type=\"kv_resolve_lock\"}[1m]))",
+		10,
+	},
+}
+
+type OperatorCategory struct {
+	Name        string
+	TypePattern string
+}
+
+var PDOperatorCategories = []OperatorCategory{
+	OperatorCategory{"balance-leader", "balance-leader"},
+	OperatorCategory{"balance-region", "balance-region"},
+	OperatorCategory{"split", ".*split.*"},
+	OperatorCategory{"merge", ".*merge.*"},
+	OperatorCategory{"hot-region", ".*hot.*"},
+	OperatorCategory{"transfer-leader", "transfer-leader|evict-leader"},
+}
+
 type SourceTask struct {
 	Source   string
 	Query    string
@@ -47,3 +160,170 @@ func GetPeriodWorkloadBreakingPointSource() []SourceTask {
 func ChooseWorkloadPeriodSmoothStep(duration time.Duration) time.Duration {
 	return 2 * time.Minute
 }
+
+// The stall duration is in microseconds
+func GetWriteStallSource() []SourceTask {
+	return []SourceTask{
+		SourceTask{
+			"prometheus",
+			"max(tikv_engine_write_stall{db=\"kv\",type=\"write_stall_max\"}) by (instance)",
+			"eq",
+		},
+	}
+}
+
+func GetWriteStallReasonSource() []SourceTask {
+	return []SourceTask{
+		SourceTask{
+			"prometheus",
+			"sum(rate(tikv_engine_write_stall_reason{db=\"kv\"}[1m])) by (instance, type)",
+			"eq",
+		},
+	}
+}
+
+// The label 'pressure' is attached for telling them apart
+func GetWriteStallPressureSource() []SourceTask {
+	return []SourceTask{
+		SourceTask{
+			"prometheus",
+			"label_replace(sum(tikv_engine_pending_compaction_bytes{db=\"kv\"}) by (instance), \"pressure\", \"pending_compaction_bytes\", \"\", \"\")",
+			"eq",
+		},
+		SourceTask{
+			"prometheus",
+			"label_replace(max(tikv_engine_num_files_at_level{db=\"kv\",level=\"0\"}) by (instance), \"pressure\", \"level0_files\", \"\", \"\")",
+			"eq",
+		},
+		SourceTask{
+			"prometheus",
+			"label_replace(max(tikv_engine_num_immutable_mem_table{db=\"kv\"}) by (instance), \"pressure\", \"memtables\", \"\", \"\")",
+			"eq",
+		},
+	}
+}
+
+// The label 'pool' is attached for telling them apart, the value is the CPU cores usage
+func GetThreadPoolUsageSource() (tasks []SourceTask) {
+	for _, pool := range TiKVThreadPools {
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(sum(rate(tikv_thread_cpu_seconds_total{name=~\"%s\"}[1m])) by (instance), "+
+				"\"pool\", \"%s\", \"\", \"\")", pool.ThreadPattern, pool.Name),
+			"eq",
+		})
+	}
+	return
+}
+
+func GetThreadPoolSizeSource() (tasks []SourceTask) {
+	for _, pool := range TiKVThreadPools {
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(count(rate(tikv_thread_cpu_seconds_total{name=~\"%s\"}[1m])) by (instance), "+
+				"\"pool\", \"%s\", \"\", \"\")", pool.ThreadPattern, pool.Name),
+			"eq",
+		})
+	}
+	return
+}
+
+// The label 'signal' is attached for telling them apart
+func GetContentionSource() (tasks []SourceTask) {
+	for _, signal := range TiDBContentionSignals {
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(%s, \"signal\", \"%s\", \"\", \"\")", signal.Query, signal.Name),
+			"eq",
+		})
+	}
+	return
+}
+
+// The value is the ratio of the store flow to the average flow of all stores,
+//   the label 'kind' (read|write) is attached for telling them apart
+func GetHotStoreSource() (tasks []SourceTask) {
+	for _, kind := range []string{"read", "write"} {
+		flow := fmt.Sprintf("sum(pd_scheduler_store_status{type=\"store_%s_rate_bytes\"}) by (address, store)", kind)
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(%s / on() group_left avg(%s), \"kind\", \"%s\", \"\", \"\")", flow, flow, kind),
+			"eq",
+		})
+	}
+	return
+}
+
+func GetHotRegionSource() (tasks []SourceTask) {
+	for _, kind := range []string{"read", "write"} {
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(sum(pd_hotspot_status{type=\"hot_%s_region_as_leader\"}) by (address, store), "+
+				"\"kind\", \"%s\", \"\", \"\")", kind, kind),
+			"eq",
+		})
+	}
+	return
+}
+
+// The value is hot regions moved out of a store per second,
+//   labels: 'store', 'rw' (read or write) and 'type' (move-leader, move-peer, ...)
+func GetHotRegionScheduleSource() []SourceTask {
+	return []SourceTask{
+		SourceTask{
+			"prometheus",
+			"sum(rate(pd_scheduler_hot_region_direction{direction=\"out\"}[1m])) by (store, rw, type)",
+			"eq",
+		},
+	}
+}
+
+// The value is operators per second of each event(create, finish, timeout, cancel, ...),
+//   the label 'category' is attached for telling them apart
+func GetSchedulingSource() (tasks []SourceTask) {
+	for _, category := range PDOperatorCategories {
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(sum(rate(pd_schedule_operators_count{type=~\"%s\"}[1m])) by (event), "+
+				"\"category\", \"%s\", \"\", \"\")", category.TypePattern, category.Name),
+			"eq",
+		})
+	}
+	return
+}
+
+// The value is in seconds
+func GetCapacityLatencySource() []SourceTask {
+	return []SourceTask{
+		SourceTask{
+			"prometheus",
+			fmt.Sprintf("histogram_quantile(%v, sum(rate(tidb_server_handle_query_duration_seconds_bucket[1m])) by (le))",
+				CapacityLatencyQuantile),
+			"eq",
+		},
+	}
+}
+
+type StatementKind struct {
+	Name        string
+	TypePattern string
+}
+
+var TiDBStatementKinds = []StatementKind{
+	{"all", ".*"},
+	{"read", "Select"},
+	{"write", "Insert|Replace|Update|Delete"},
+}
+
+// The value is in seconds, the label 'kind' is attached for telling them apart
+func GetHistoryLatencySource() (tasks []SourceTask) {
+	for _, kind := range TiDBStatementKinds {
+		tasks = append(tasks, SourceTask{
+			"prometheus",
+			fmt.Sprintf("label_replace(histogram_quantile(%v, sum(rate(tidb_server_handle_query_duration_seconds_bucket{sql_type=~\"%s\"}[1m])) by (le)), "+
+				"\"kind\", \"%s\", \"\", \"\")", HistoryLatencyQuantile, kind.TypePattern, kind.Name),
+			"eq",
+		})
+	}
+	return
+}
@@ -2,43 +2,61 @@ package base
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 type Console struct {
 	verbLevel int
+	out       io.Writer
 }
 
-func NewConsole(verbLevel string) Console {
+func NewConsole(verbLevel string) (Console, error) {
 	switch verbLevel {
 	case "debug":
-		return Console{verbLevelDebug}
+		return Console{verbLevelDebug, os.Stdout}, nil
 	case "detail":
-		return Console{verbLevelDetail}
+		return Console{verbLevelDetail, os.Stdout}, nil
 	case "compact":
-		return Console{verbLevelCompact}
+		return Console{verbLevelCompact, os.Stdout}, nil
 	}
-	panic("unknown verb level: '" + verbLevel + "', should be: debug, detail, compact")
+	return Console{}, fmt.Errorf("unknown verb level: '" + verbLevel + "', should be: debug, detail, compact")
+}
+
+// Print to the writer in detail level, for capturing the output
+func NewDetailConsole(out io.Writer) Console {
+	return Console{verbLevelDetail, out}
+}
+
+// The same verb level, print to another writer
+func (c Console) WithWriter(out io.Writer) Console {
+	return Console{c.verbLevel, out}
+}
+
+// For skipping the costly preparing of the detail output
+func (c Console) DetailEnabled() bool {
+	return c.verbLevel <= verbLevelDetail
 }
 
 func (c Console) Debug(msg ...interface{}) {
 	if c.verbLevel > verbLevelDebug {
 		return
 	}
-	fmt.Print(msg...)
+	fmt.Fprint(c.out, msg...)
 }
 
 func (c Console) Detail(msg ...interface{}) {
 	if c.verbLevel > verbLevelDetail {
 		return
 	}
-	fmt.Print(msg...)
+	fmt.Fprint(c.out, msg...)
 }
 
 func (c Console) Compact(msg ...interface{}) {
 	if c.verbLevel > verbLevelCompact {
 		return
 	}
-	fmt.Print(msg...)
+	fmt.Fprint(c.out, msg...)
 }
 
 const (
@@ -0,0 +1,96 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The similarity of two adjacent samples can't be calculated, but they are not both inactive
+type NaNSimilarityError struct {
+	Time time.Time
+	Prev PeriodVec
+	Curr PeriodVec
+}
+
+func (e NaNSimilarityError) Error() string {
+	return fmt.Sprintf("similarity is NaN at %s: %v vs %v", e.Time.Format(TimeFormat), e.Prev, e.Curr)
+}
+
+// The vectors from one query have different timestamps at the same index
+type TimestampMismatchError struct {
+	Index    int
+	Expected time.Time
+	Got      time.Time
+}
+
+func (e TimestampMismatchError) Error() string {
+	return fmt.Sprintf("timestamps not matched in multiply vectors from one query at #%d: %s vs %s",
+		e.Index, e.Expected.Format(TimeFormat), e.Got.Format(TimeFormat))
+}
+
+type SplittingPointError struct {
+	Points []time.Time
+}
+
+func (e SplittingPointError) Error() string {
+	var points []string
+	for _, point := range e.Points {
+		points = append(points, point.Format(TimeFormat))
+	}
+	return "splitting points out of range: " + strings.Join(points, ", ")
+}
+
+// An error with the analysis step it occurred in
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e StepError) Error() string {
+	return e.Step + ": " + e.Err.Error()
+}
+
+func (e StepError) Unwrap() error {
+	return e.Err
+}
+
+// Some steps failed, but the result is still usable
+type PartialError struct {
+	Errors []error
+}
+
+func (e *PartialError) Add(err error) {
+	if err == nil {
+		return
+	}
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		e.Errors = append(e.Errors, partial.Errors...)
+		return
+	}
+	e.Errors = append(e.Errors, err)
+}
+
+// Return nil if nothing failed
+func (e *PartialError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *PartialError) Error() string {
+	var errs []string
+	for _, err := range e.Errors {
+		errs = append(errs, err.Error())
+	}
+	return fmt.Sprintf("%d step(s) failed: %s", len(e.Errors), strings.Join(errs, "; "))
+}
+
+// A partial error means the result is still usable
+func IsPartial(err error) bool {
+	var partial *PartialError
+	return errors.As(err, &partial)
+}
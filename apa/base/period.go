@@ -12,32 +12,186 @@ type Period struct {
 	End         time.Time
 	StartReason interface{}
 	EndReason   interface{}
+
+	// The scrape gaps in this period
+	Gaps []Gap
+
+	// Judged only if seasonality is specified
+	Seasonal *SeasonalJudgement
+
+	// A short period between two different workloads, not a full period
+	Transition bool
+
+	// The finer periods inside this one, detected by a higher similarity threshold
+	Children []Period
+}
+
+// Get the periods in the specified level of the tree, a period without children is used as itself in the deeper levels
+func FlattenPeriods(periods []Period, level int) (flatten []Period) {
+	for _, period := range periods {
+		if level <= 0 || len(period.Children) == 0 {
+			flatten = append(flatten, period)
+		} else {
+			flatten = append(flatten, FlattenPeriods(period.Children, level-1)...)
+		}
+	}
+	return
 }
 
+// Remove the periods (and children) ended before the specified time
+func TrimPeriods(periods []Period, from time.Time) (trimmed []Period) {
+	for _, period := range periods {
+		if !period.End.After(from) {
+			continue
+		}
+		period.Children = TrimPeriods(period.Children, from)
+		trimmed = append(trimmed, period)
+	}
+	return
+}
+
+// The children of the merged period, a period without children is used as itself
+func MergeChildren(periods ...Period) (children []Period) {
+	hasChildren := false
+	for _, period := range periods {
+		hasChildren = hasChildren || len(period.Children) != 0
+	}
+	if !hasChildren {
+		return
+	}
+	for _, period := range periods {
+		if len(period.Children) == 0 {
+			period.Seasonal = nil
+			children = append(children, period)
+		} else {
+			children = append(children, period.Children...)
+		}
+	}
+	return
+}
+
+// Get the workload of this period from the breaking reasons, the first or the last period has only one
+func (p Period) Workload() (desc WorkloadDesc, ok bool) {
+	if reason, ok := p.StartReason.(WorkloadBreakingReason); ok {
+		return reason.CurrWorkload, true
+	}
+	if reason, ok := p.EndReason.(WorkloadBreakingReason); ok {
+		return reason.PrevWorkload, true
+	}
+	return
+}
+
+// Merge the short period B in A-B-A pattern back if the two A are similar, otherwise mark B as a transition.
+// The first and the last periods are not touched, they may be incompleted. The children are handled in the same way.
+// The thresholds are the similarity thresholds of the period tree levels, the first one is of these periods.
+func MergeShortPeriods(origin []Period, minDuration time.Duration, thresholds []float64, con Console) (periods []Period) {
+	periods = origin
+	if minDuration <= 0 {
+		return
+	}
+	threshold := WorkloadPeriodThreshold
+	if len(thresholds) != 0 {
+		threshold = thresholds[0]
+		thresholds = thresholds[1:]
+	}
+	for i := range periods {
+		periods[i].Children = MergeShortPeriods(periods[i].Children, minDuration, thresholds, con)
+	}
+	for merged := true; merged; {
+		merged = false
+		for i := 1; i+1 < len(periods); i++ {
+			curr := periods[i]
+			if curr.Transition || curr.End.Sub(curr.Start) >= minDuration {
+				continue
+			}
+			prev := periods[i-1]
+			next := periods[i+1]
+			prevDesc, ok1 := prev.Workload()
+			nextDesc, ok2 := next.Workload()
+			if ok1 && ok2 && !prev.Transition && !next.Transition &&
+				CosineSimilarity(prevDesc.Vec(), nextDesc.Vec()) >= threshold {
+				con.Debug("## merged flapping period ", curr.Start.Format(TimeFormat), " => ", curr.End.Format(TimeFormat), "\n")
+				gaps := append(append(append([]Gap{}, prev.Gaps...), curr.Gaps...), next.Gaps...)
+				mergedPeriod := Period{
+					Start:       prev.Start,
+					End:         next.End,
+					StartReason: prev.StartReason,
+					EndReason:   next.EndReason,
+					Gaps:        gaps,
+					Children:    MergeChildren(prev, curr, next),
+				}
+				periods = append(append(append([]Period{}, periods[:i-1]...), mergedPeriod), periods[i+2:]...)
+				merged = true
+				break
+			}
+			periods[i].Transition = true
+		}
+	}
+	return
+}
+
+// If the seasonality is valid, the changes following the seasonal baseline are not breaking points.
+// The collected vectors are also returned, aligned by time, for reusing.
 func CollectPrecisePointsBySimilarity(data sources.Sources, sources []SourceTask, period Period, step time.Duration,
-	similarityThreshold float64, zoomInSpeed int, con Console) (points []time.Time, reasons []interface{}, err error) {
+	similarityThreshold float64, seasonality Seasonality, zoomInSpeed int, con Console) (points []time.Time,
+	reasons []interface{}, gaps []Gap, aligned []CollectedSourceTasks, err error) {
 
+	queryStep := step
 	vectors, err := CollectSources(data, sources, period.Start, period.End, step)
 	if err != nil || len(vectors) == 0 {
 		return
 	}
-	similarities, rawVecs, times := CalculateSimilarities(vectors)
+	similarities, rawVecs, times, gaps, err := CalculateSimilarities(vectors)
+	if err != nil {
+		err = StepError{"calculate similarities", err}
+		return
+	}
+	aligned = rawVecs
 	if len(similarities) < 2 {
 		return
 	}
+	for _, gap := range gaps {
+		con.Debug("## scrape gap ", gap, "\n")
+	}
 
-	// Step may be ajusted
+	// The failed zoom-in steps are collected, the rough points are used instead
+	var partial PartialError
+
+	// Step may be ajusted, use the min interval in case of scrape gaps
 	step = times[1].Sub(times[0])
+	for i := 2; i < len(times); i++ {
+		if times[i].Sub(times[i-1]) < step {
+			step = times[i].Sub(times[i-1])
+		}
+	}
 
 	rawPoints := []time.Time{}
 	rawReasons := []SimilarityBreakingReason{}
 
+	// Collected at the first change
+	var baseline *SeasonalBaseline
+
 	for i := 1; i < len(similarities); i++ {
 		similarity := similarities[i]
 		if similarity >= similarityThreshold {
 			continue
 		}
 
+		if seasonality.Valid() && baseline == nil {
+			collected, baselineErr := CollectSeasonalBaseline(data, sources, seasonality, period.Start, period.End, queryStep)
+			if baselineErr != nil {
+				partial.Add(StepError{"collect " + seasonality.Name + " baseline", baselineErr})
+				seasonality = Seasonality{}
+			} else {
+				con.Debug("## collected ", seasonality.Name, " baseline of ", collected.Cycles, " cycle(s)\n")
+				baseline = &collected
+			}
+		}
+		if baseline != nil && baseline.Explains(rawVecs, i, similarityThreshold) {
+			con.Debug("## seasonal change at ", times[i].Format(TimeFormat), ", similarity ", similarity, ", skipped\n")
+			continue
+		}
+
 		// Double the range to make sure nothing missed
 		zoomInStart := times[i-1].Add(-step)
 		zoomInEnd := times[i].Add(step * 2)
@@ -55,10 +209,15 @@ func CollectPrecisePointsBySimilarity(data sources.Sources, sources []SourceTask
 		if zoomInStep != step {
 			con.Debug("## before zoom-in ", zoomInStart.Format(TimeFormat), " => ", zoomInEnd.Format(TimeFormat),
 				", parent-step ", step, ", parent-similarity ", similarity, ", zoom-in-step ", zoomInStep, "\n")
-			zoomedSimilarities, zoomedTimes, zoomedStep, zoomed, err = ZoomInBySimilarity(data, sources,
+			var zoomErr error
+			zoomedSimilarities, zoomedTimes, zoomedStep, zoomed, zoomErr = ZoomInBySimilarity(data, sources,
 				zoomInStart, zoomInEnd, similarityThreshold, zoomInSpeed, zoomInStep, minStep, 0, con)
-			if err != nil {
-				return nil, nil, err
+			if zoomErr != nil {
+				if !IsPartial(zoomErr) {
+					zoomed = false
+				}
+				con.Debug("## zoom-in failed, ", zoomErr, "\n")
+				partial.Add(StepError{"zoom in " + zoomInStart.Format(TimeFormat) + " => " + zoomInEnd.Format(TimeFormat), zoomErr})
 			}
 		}
 
@@ -89,12 +248,12 @@ func CollectPrecisePointsBySimilarity(data sources.Sources, sources []SourceTask
 		}
 	}
 
-	// Remove duplicated points and out of range points
+	// Remove duplicated points and out of range points, the points on the range ends make empty periods
 	dedPoints := []time.Time{}
 	dedReasons := []SimilarityBreakingReason{}
 	var prev time.Time
 	for i, point := range rawPoints {
-		if point.Before(period.Start) || point.After(period.End) {
+		if !point.After(period.Start) || !point.Before(period.End) {
 			con.Debug("## throw away point ", point.Format(TimeFormat), "\n")
 			continue
 		}
@@ -112,12 +271,17 @@ func CollectPrecisePointsBySimilarity(data sources.Sources, sources []SourceTask
 	}
 
 	if len(dedPoints) == 0 {
+		err = partial.Err()
 		return
 	}
 
-	descs := CaculateWorkloadDescs(rawVecs, dedPoints)
-	if len(descs) != len(dedPoints)+1 {
-		panic(fmt.Sprintf("len(workload descs) should be len(points)+1, got: %v vs %v", len(descs), len(dedPoints)))
+	descs, err := CaculateWorkloadDescs(rawVecs, dedPoints)
+	if err == nil && len(descs) != len(dedPoints)+1 {
+		err = fmt.Errorf("len(workload descs) should be len(points)+1, got: %v vs %v", len(descs), len(dedPoints))
+	}
+	if err != nil {
+		err = StepError{"calculate workload descs", err}
+		return
 	}
 
 	// TODO: Remove inactive points
@@ -130,6 +294,7 @@ func CollectPrecisePointsBySimilarity(data sources.Sources, sources []SourceTask
 	points = append(points, period.End)
 	reasons = append(reasons, period.EndReason)
 
+	err = partial.Err()
 	return
 }
 
@@ -146,7 +311,10 @@ func ZoomInBySimilarity(data sources.Sources, sources []SourceTask, start time.T
 	if err != nil || len(vectors) == 0 {
 		return
 	}
-	rawSimilarities, _, rawTimes := CalculateSimilarities(vectors)
+	rawSimilarities, _, rawTimes, _, err := CalculateSimilarities(vectors)
+	if err != nil {
+		return
+	}
 
 	// Scale too little, not a succeeded zooming
 	if len(rawTimes) < 2 {
@@ -174,15 +342,16 @@ func ZoomInBySimilarity(data sources.Sources, sources []SourceTask, start time.T
 		return
 	}
 
-	// Looping zoom-in for more precise points
+	// Looping zoom-in for more precise points, use the current point if failed
+	var partial PartialError
 	for i, it := range times {
 		rezoomStep := step / time.Duration(speed)
 		rezoomedSimilarities, rezoomedTimes, _, rezoomed, rezoomErr := ZoomInBySimilarity(
 			data, sources, it.Add(-2*step), it.Add(2*step), similarityThreshold, speed,
 			rezoomStep, minStep, level+1, con)
 		if rezoomErr != nil {
-			err = rezoomErr
-			return
+			partial.Add(StepError{fmt.Sprintf("zoom in level %d at %s", level+1, it.Format(TimeFormat)), rezoomErr})
+			rezoomed = rezoomed && IsPartial(rezoomErr)
 		}
 		if rezoomed {
 			for j, similarity := range rezoomedSimilarities {
@@ -198,10 +367,11 @@ func ZoomInBySimilarity(data sources.Sources, sources []SourceTask, start time.T
 	// TODO: the zoomedStep maybe wrong, some points may from re-zoom result
 	zoomedStep = step
 	zoomed = true
+	err = partial.Err()
 	return
 }
 
-func CaculateWorkloadDescs(vecs []CollectedSourceTasks, splittingPoints []time.Time) (descs []WorkloadDesc) {
+func CaculateWorkloadDescs(vecs []CollectedSourceTasks, splittingPoints []time.Time) (descs []WorkloadDesc, err error) {
 	if len(vecs) == 0 || len(vecs[0].Pairs) == 0 || len(splittingPoints) == 0 {
 		return
 	}
@@ -230,7 +400,7 @@ func CaculateWorkloadDescs(vecs []CollectedSourceTasks, splittingPoints []time.T
 	}
 
 	if pointIdx < len(splittingPoints) {
-		panic("some splitting points out of range")
+		return nil, SplittingPointError{splittingPoints[pointIdx:]}
 	}
 
 	sums = make([]float64, len(vecs))
@@ -259,37 +429,82 @@ func (w WorkloadDesc) RawString() string {
 }
 
 func (w WorkloadDesc) String() string {
-	read := w.AvgQpsCoprocessor + w.AvgQpsBatchGet + w.AvgQpsBatchGetCommand
-	write := w.AvgQpsCommit + w.AvgQpsPessimisticLock + w.AvgQpsPrewrite
+	level := w.Level()
+	if level == "inactive" {
+		return level
+	}
+	return level + " " + w.Type()
+}
+
+func (w WorkloadDesc) Qps() (read float64, write float64) {
+	read = w.AvgQpsCoprocessor + w.AvgQpsBatchGet + w.AvgQpsBatchGetCommand
+	write = w.AvgQpsCommit + w.AvgQpsPessimisticLock + w.AvgQpsPrewrite
 	read /= 2
 	write /= 2
-	total := read + write
+	return
+}
 
-	level := "inactive"
+func (w WorkloadDesc) Level() string {
+	read, write := w.Qps()
+	total := read + write
 	if total >= QpsThresholdHeavy {
-		level = "heavy"
+		return "heavy"
 	} else if total >= QpsThresholdAlot {
-		level = "medium"
+		return "medium"
 	} else if total >= QpsThresholdActive {
-		level = "slight"
-	} else {
-		return level
-	}
-
-	writeTp := "write"
-	if w.AvgQpsPessimisticLock > QpsThresholdActive && (w.AvgQpsCommit+w.AvgQpsPrewrite) > QpsThresholdActive &&
-		w.AvgQpsPessimisticLock/(w.AvgQpsCommit+w.AvgQpsPrewrite) > 0.1 {
-		writeTp = "pessimistic write"
+		return "slight"
 	}
+	return "inactive"
+}
 
+// The workload class without the level, eg: read, write, read and pessimistic write
+func (w WorkloadDesc) Type() string {
+	read, write := w.Qps()
+	writeTp := w.WriteType()
 	tp := "read and " + writeTp
 	if write == 0 || read/write > 20 {
 		tp = "read"
 	} else if read == 0 || write/read > 20 {
 		tp = writeTp
 	}
+	return tp
+}
 
-	return level + " " + tp
+func (w WorkloadDesc) WriteType() string {
+	if w.AvgQpsPessimisticLock > QpsThresholdActive && (w.AvgQpsCommit+w.AvgQpsPrewrite) > QpsThresholdActive &&
+		w.AvgQpsPessimisticLock/(w.AvgQpsCommit+w.AvgQpsPrewrite) > 0.1 {
+		return "pessimistic write"
+	}
+	return "write"
+}
+
+// The average workload of the aligned vectors in [start, end), for the periods without workload breaking reasons
+func WorkloadDescInRange(vecs []CollectedSourceTasks, start time.Time, end time.Time) (desc WorkloadDesc, ok bool) {
+	if len(vecs) == 0 {
+		return
+	}
+	names := make([]string, len(vecs))
+	sums := make([]float64, len(vecs))
+	samples := 0
+	for i, vec := range vecs {
+		names[i] = string(vec.Metric["type"])
+		count := 0
+		for _, pair := range vec.Pairs {
+			t := Ms2Time(pair.Timestamp)
+			if t.Before(start) || !t.Before(end) {
+				continue
+			}
+			sums[i] += float64(pair.Value)
+			count += 1
+		}
+		if i == 0 {
+			samples = count
+		}
+	}
+	if samples == 0 {
+		return
+	}
+	return NewWorkloadDesc(sums, names, samples), true
 }
 
 func NewWorkloadDesc(sums []float64, names []string, samples int) (desc WorkloadDesc) {
@@ -322,3 +537,56 @@ type WorkloadBreakingReason struct {
 func (w WorkloadBreakingReason) String() string {
 	return fmt.Sprintf("from %v to %v (sim: %.2f)", w.PrevWorkload, w.CurrWorkload, w.Similarity.Similarity)
 }
+
+// A period boundary forced by user, not detected
+type ForcedBreakingReason struct {
+	Note string
+}
+
+func (f ForcedBreakingReason) String() string {
+	return "forced by annotation: " + f.Note
+}
+
+// Split the period (and the children) containing the time into two
+func SplitPeriods(periods []Period, at time.Time, reason interface{}) (split []Period) {
+	for _, period := range periods {
+		if !at.After(period.Start) || !at.Before(period.End) {
+			split = append(split, period)
+			continue
+		}
+		left := period
+		left.End = at
+		left.EndReason = reason
+		left.Gaps = nil
+		left.Children = nil
+		right := period
+		right.Start = at
+		right.StartReason = reason
+		right.Gaps = nil
+		right.Children = nil
+		for _, gap := range period.Gaps {
+			if gap.Start.Before(at) {
+				left.Gaps = append(left.Gaps, gap)
+			}
+			if gap.End.After(at) {
+				right.Gaps = append(right.Gaps, gap)
+			}
+		}
+		for _, child := range SplitPeriods(period.Children, at, reason) {
+			if child.End.After(at) {
+				right.Children = append(right.Children, child)
+			} else {
+				left.Children = append(left.Children, child)
+			}
+		}
+		// A single child is the same as the parent
+		if len(left.Children) == 1 {
+			left.Children = nil
+		}
+		if len(right.Children) == 1 {
+			right.Children = nil
+		}
+		split = append(split, left, right)
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package base
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestWorkloadDescInRange(t *testing.T) {
+	vecs := []CollectedSourceTasks{
+		minuteVector("kv_batch_get", map[int]float64{0: 100, 1: 100, 2: 300, 3: 300}),
+		minuteVector("kv_commit", map[int]float64{0: 10, 1: 30, 2: 0, 3: 0}),
+	}
+	cases := []struct {
+		name     string
+		start    int
+		end      int
+		batchGet float64
+		commit   float64
+		ok       bool
+	}{
+		{"whole range", 0, 4, 200, 10, true},
+		{"first half", 0, 2, 100, 20, true},
+		{"end excluded", 2, 3, 300, 0, true},
+		{"no samples", 5, 6, 0, 0, false},
+	}
+	for _, c := range cases {
+		desc, ok := WorkloadDescInRange(vecs, minuteTime(c.start), minuteTime(c.end))
+		if ok != c.ok {
+			t.Errorf("%s: expected ok %v, got %v", c.name, c.ok, ok)
+			continue
+		}
+		if desc.AvgQpsBatchGet != c.batchGet || desc.AvgQpsCommit != c.commit {
+			t.Errorf("%s: expected batch get %v commit %v, got %v", c.name, c.batchGet, c.commit, desc)
+		}
+	}
+
+	if _, ok := WorkloadDescInRange(nil, minuteTime(0), minuteTime(4)); ok {
+		t.Errorf("expected no workload without vectors")
+	}
+}
+
+func TestMergeShortPeriodsByLevel(t *testing.T) {
+	a := WorkloadDesc{AvgQpsBatchGet: 100}
+	b := WorkloadDesc{AvgQpsCoprocessor: 100}
+	// Similarity to a is about 0.7
+	alike := WorkloadDesc{AvgQpsBatchGet: 100, AvgQpsCommit: 100}
+	flapping := func() []Period {
+		toB := WorkloadBreakingReason{PrevWorkload: a, CurrWorkload: b}
+		toAlike := WorkloadBreakingReason{PrevWorkload: b, CurrWorkload: alike}
+		return []Period{
+			{Start: minuteTime(0), End: minuteTime(30), StartReason: "start", EndReason: toB},
+			{Start: minuteTime(30), End: minuteTime(32), StartReason: toB, EndReason: toAlike},
+			{Start: minuteTime(32), End: minuteTime(60), StartReason: toAlike, EndReason: "end"},
+		}
+	}
+	nested := func() []Period {
+		return []Period{{Start: minuteTime(0), End: minuteTime(60), StartReason: "start", EndReason: "end",
+			Children: flapping()}}
+	}
+
+	cases := []struct {
+		name        string
+		origin      []Period
+		thresholds  []float64
+		count       int
+		transitions int
+	}{
+		{"merged", flapping(), []float64{0.5}, 1, 0},
+		{"transition", flapping(), []float64{0.9}, 3, 1},
+		{"default threshold", flapping(), nil, 1, 0},
+		{"children merged by their level", nested(), []float64{0.3, 0.5}, 1, 0},
+		{"children judged by their level", nested(), []float64{0.3, 0.9}, 3, 1},
+	}
+	for _, c := range cases {
+		periods := MergeShortPeriods(c.origin, 5*time.Minute, c.thresholds, NewDetailConsole(ioutil.Discard))
+		if len(c.origin[0].Children) != 0 {
+			periods = periods[0].Children
+		}
+		transitions := 0
+		for _, period := range periods {
+			if period.Transition {
+				transitions += 1
+			}
+		}
+		if len(periods) != c.count || transitions != c.transitions {
+			t.Errorf("%s: expected %d periods with %d transitions, got %d with %d", c.name,
+				c.count, c.transitions, len(periods), transitions)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package base
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+type Seasonality struct {
+	Name  string
+	Cycle time.Duration
+	// The granularity of the baseline, eg: 'day' means the same time of day
+	Unit string
+	// The max count of history cycles for baseline, also limited by AutoModeMaxDuration
+	MaxCycles int
+}
+
+func ParseSeasonality(name string) (seasonality Seasonality, err error) {
+	switch name {
+	case "daily":
+		return Seasonality{name, 24 * time.Hour, "day", SeasonalDailyMaxCycles}, nil
+	case "weekly":
+		return Seasonality{name, 7 * 24 * time.Hour, "week", SeasonalWeeklyMaxCycles}, nil
+	}
+	err = fmt.Errorf("unknown seasonality: '" + name + "', should be: daily|weekly")
+	return
+}
+
+func (s Seasonality) Valid() bool {
+	return s.Cycle > 0
+}
+
+// The shifts of the history cycles for a range lasted the duration
+func (s Seasonality) Shifts(duration time.Duration) (shifts []time.Duration) {
+	for i := 1; i <= s.MaxCycles; i++ {
+		shift := s.Cycle * time.Duration(i)
+		if shift+duration > AutoModeMaxDuration {
+			break
+		}
+		shifts = append(shifts, shift)
+	}
+	return
+}
+
+// The average samples of the same times in history cycles, keyed by the current times and the 'type' labels
+type SeasonalBaseline struct {
+	Cycles int
+	sums   map[model.Time]map[string]float64
+	counts map[model.Time]int
+}
+
+func CollectSeasonalBaseline(data sources.Sources, sources []SourceTask, seasonality Seasonality, start time.Time,
+	end time.Time, step time.Duration) (baseline SeasonalBaseline, err error) {
+
+	baseline.sums = make(map[model.Time]map[string]float64)
+	baseline.counts = make(map[model.Time]int)
+	for _, shift := range seasonality.Shifts(end.Sub(start)) {
+		var vectors []CollectedSourceTasks
+		vectors, err = CollectSources(data, sources, start.Add(-shift), end.Add(-shift), step)
+		if err != nil {
+			return
+		}
+		vectors, _ = AlignVectorsByTime(vectors)
+		if len(vectors) == 0 || len(vectors[0].Pairs) == 0 {
+			continue
+		}
+		offset := model.Time(shift / time.Millisecond)
+		for _, pair := range vectors[0].Pairs {
+			t := pair.Timestamp + offset
+			baseline.counts[t] += 1
+			if baseline.sums[t] == nil {
+				baseline.sums[t] = make(map[string]float64)
+			}
+		}
+		for _, vector := range vectors {
+			name := string(vector.Metric["type"])
+			for _, pair := range vector.Pairs {
+				baseline.sums[pair.Timestamp+offset][name] += float64(pair.Value)
+			}
+		}
+		baseline.Cycles += 1
+	}
+	return
+}
+
+// The change between the samples #i-1 and #i of the aligned vectors is seasonal,
+// if the samples on both sides are similar to the baseline at the same times
+func (b SeasonalBaseline) Explains(vectors []CollectedSourceTasks, i int, threshold float64) bool {
+	if i < 1 || len(vectors) == 0 {
+		return false
+	}
+	for _, j := range []int{i - 1, i} {
+		t := vectors[0].Pairs[j].Timestamp
+		if b.counts[t] == 0 {
+			return false
+		}
+		var curr, baseline PeriodVec
+		for _, vector := range vectors {
+			curr = append(curr, float64(vector.Pairs[j].Value))
+			baseline = append(baseline, b.sums[t][string(vector.Metric["type"])]/float64(b.counts[t]))
+		}
+		similarity := CosineSimilarity(curr, baseline)
+		if math.IsNaN(similarity) {
+			// Both inactive is similar, only one inactive is not
+			if curr.Sum() != 0 || baseline.Sum() != 0 {
+				return false
+			}
+			continue
+		}
+		if similarity < threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare a period's workload to the average workload of the same time in history cycles
+type SeasonalJudgement struct {
+	Seasonality Seasonality
+	Baseline    WorkloadDesc
+	Cycles      int
+	Similarity  float64
+	VolumeRatio float64
+	Normal      bool
+}
+
+func (s SeasonalJudgement) String() string {
+	if s.Cycles == 0 {
+		return "no " + s.Seasonality.Name + " history to compare"
+	}
+	desc := "normal for this time of " + s.Seasonality.Unit
+	if !s.Normal {
+		desc = "not normal for this time of " + s.Seasonality.Unit
+	}
+	return fmt.Sprintf("%s, similarity %.2f, %.1fx of the same time in last %d %s cycle(s)",
+		desc, s.Similarity, s.VolumeRatio, s.Cycles, s.Seasonality.Name)
+}
+
+func (w WorkloadDesc) Vec() PeriodVec {
+	return PeriodVec{
+		w.AvgQpsCoprocessor, w.AvgQpsBatchGet, w.AvgQpsBatchGetCommand,
+		w.AvgQpsCommit, w.AvgQpsPessimisticLock, w.AvgQpsPrewrite,
+	}
+}
+
+// The names of the values in Vec, in the same order
+var WorkloadDescNames = []string{"coprocessor", "kv_batch_get", "kv_batch_get_command", "kv_commit", "kv_pessimistic_lock", "kv_prewrite"}
+
+// The average workload in [start, end]
+func CollectWorkloadDesc(data sources.Sources, start time.Time, end time.Time) (desc WorkloadDesc, ok bool, err error) {
+	step := ChooseWorkloadPeriodSmoothStep(end.Sub(start))
+	vectors, err := CollectSources(data, GetPeriodWorkloadBreakingPointSource(), start, end, step)
+	if err != nil || len(vectors) == 0 {
+		return
+	}
+	vectors, _ = AlignVectorsByTime(vectors)
+	if len(vectors[0].Pairs) == 0 {
+		return
+	}
+	names := make([]string, len(vectors))
+	sums := make([]float64, len(vectors))
+	for i, vector := range vectors {
+		names[i] = string(vector.Metric["type"])
+		for _, pair := range vector.Pairs {
+			sums[i] += float64(pair.Value)
+		}
+	}
+	return NewWorkloadDesc(sums, names, len(vectors[0].Pairs)), true, nil
+}
+
+func JudgeSeasonality(data sources.Sources, seasonality Seasonality, start time.Time, end time.Time,
+	con Console) (judgement SeasonalJudgement, err error) {
+
+	judgement.Seasonality = seasonality
+	curr, ok, err := CollectWorkloadDesc(data, start, end)
+	if err != nil || !ok {
+		return
+	}
+
+	var sums PeriodVec
+	for _, shift := range seasonality.Shifts(end.Sub(start)) {
+		var history WorkloadDesc
+		history, ok, err = CollectWorkloadDesc(data, start.Add(-shift), end.Add(-shift))
+		if err != nil {
+			return
+		}
+		if !ok {
+			con.Debug("    ## no history of ", shift, " ago\n")
+			continue
+		}
+		vec := history.Vec()
+		if sums == nil {
+			sums = make(PeriodVec, len(vec))
+		}
+		for j, it := range vec {
+			sums[j] += it
+		}
+		judgement.Cycles += 1
+	}
+	if judgement.Cycles == 0 {
+		return
+	}
+	for i, _ := range sums {
+		sums[i] /= float64(judgement.Cycles)
+	}
+	judgement.Baseline = WorkloadDesc{sums[0], sums[1], sums[2], sums[3], sums[4], sums[5]}
+
+	currSum := curr.Vec().Sum()
+	baseSum := sums.Sum()
+	judgement.Similarity = CosineSimilarity(curr.Vec(), sums)
+	if math.IsNaN(judgement.Similarity) {
+		// Both inactive is normal, only one inactive is not
+		judgement.Similarity = 0
+		if currSum == 0 && baseSum == 0 {
+			judgement.Similarity = 1
+		}
+	}
+	if baseSum > 0 {
+		judgement.VolumeRatio = currSum / baseSum
+	} else if currSum == 0 {
+		judgement.VolumeRatio = 1
+	} else {
+		judgement.VolumeRatio = math.Inf(1)
+	}
+	judgement.Normal = judgement.Similarity >= WorkloadPeriodThreshold &&
+		judgement.VolumeRatio <= SeasonalVolumeTolerance && judgement.VolumeRatio >= 1/SeasonalVolumeTolerance
+	return
+}
@@ -0,0 +1,114 @@
+package base
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A latency SLO is breached when the quantile exceeds the threshold, type '*' matches all types
+type LatencySLO struct {
+	Component string
+	Type      string
+	Quantile  float64
+	Threshold time.Duration
+}
+
+func (l LatencySLO) QuantileName() string {
+	return "p" + strconv.FormatFloat(l.Quantile*100, 'f', -1, 64)
+}
+
+func (l LatencySLO) String() string {
+	return fmt.Sprintf("%s:%s:%s<%v", l.Component, l.Type, l.QuantileName(), l.Threshold)
+}
+
+// The label of the statement or gRPC type in the histogram
+func (l LatencySLO) TypeLabel() string {
+	if l.Component == "tidb" {
+		return "sql_type"
+	}
+	return "type"
+}
+
+// Format: component:type:quantile<threshold, examples: 'tidb:Select:p99<50ms', 'tikv:*:p999<100ms'
+func ParseLatencySLO(s string) (slo LatencySLO, err error) {
+	fields := strings.SplitN(s, ":", 3)
+	if len(fields) != 3 {
+		err = fmt.Errorf("parsing slo, should be 'component:type:quantile<threshold', got: " + s)
+		return
+	}
+	slo.Component = fields[0]
+	slo.Type = fields[1]
+	if slo.Component != "tidb" && slo.Component != "tikv" {
+		err = fmt.Errorf("parsing slo, unknown component: " + slo.Component + ", should be: tidb|tikv")
+		return
+	}
+	if len(slo.Type) == 0 {
+		err = fmt.Errorf("parsing slo, empty type in: " + s)
+		return
+	}
+
+	condition := strings.SplitN(fields[2], "<", 2)
+	if len(condition) != 2 || !strings.HasPrefix(condition[0], "p") || len(condition[0]) < 2 {
+		err = fmt.Errorf("parsing slo, bad condition, should be like 'p99<50ms', got: " + fields[2])
+		return
+	}
+	digits := condition[0][1:]
+	if strings.Trim(digits, "0123456789") != "" {
+		err = fmt.Errorf("parsing slo, bad quantile: " + condition[0])
+		return
+	}
+	slo.Quantile, err = strconv.ParseFloat("0."+digits, 64)
+	if err != nil || slo.Quantile <= 0 {
+		err = fmt.Errorf("parsing slo, bad quantile: " + condition[0])
+		return
+	}
+	slo.Threshold, err = time.ParseDuration(condition[1])
+	if err != nil {
+		return
+	}
+	if slo.Threshold <= 0 {
+		err = fmt.Errorf("parsing slo, threshold should be positive, got: " + condition[1])
+	}
+	return
+}
+
+func ParseLatencySLOs(args []string) (slos []LatencySLO, err error) {
+	for _, arg := range args {
+		var slo LatencySLO
+		slo, err = ParseLatencySLO(arg)
+		if err != nil {
+			return
+		}
+		slos = append(slos, slo)
+	}
+	return
+}
+
+func DefaultLatencySLOs() []LatencySLO {
+	return []LatencySLO{
+		LatencySLO{"tidb", "*", 0.99, time.Second},
+		LatencySLO{"tikv", "*", 0.99, 500 * time.Millisecond},
+	}
+}
+
+// The value is in seconds
+func GetLatencySLOSource(slo LatencySLO) []SourceTask {
+	metric := "tikv_grpc_msg_duration_seconds_bucket"
+	if slo.Component == "tidb" {
+		metric = "tidb_server_handle_query_duration_seconds_bucket"
+	}
+	label := slo.TypeLabel()
+	filter := ""
+	if slo.Type != "*" {
+		filter = fmt.Sprintf("{%s=\"%s\"}", label, slo.Type)
+	}
+	return []SourceTask{
+		SourceTask{
+			"prometheus",
+			fmt.Sprintf("histogram_quantile(%v, sum(rate(%s%s[1m])) by (le, %s))", slo.Quantile, metric, filter, label),
+			"eq",
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package base
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLatencySLO(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected LatencySLO
+		quantile string
+		err      string
+	}{
+		{"tidb:Select:p99<50ms", LatencySLO{"tidb", "Select", 0.99, 50 * time.Millisecond}, "p99", ""},
+		{"tikv:*:p999<100ms", LatencySLO{"tikv", "*", 0.999, 100 * time.Millisecond}, "p99.9", ""},
+		{"tikv:kv_get:p9<1s", LatencySLO{"tikv", "kv_get", 0.9, time.Second}, "p90", ""},
+		{"tidb:Select", LatencySLO{}, "", "should be 'component:type:quantile<threshold'"},
+		{"pd:*:p99<50ms", LatencySLO{}, "", "unknown component"},
+		{"tidb::p99<50ms", LatencySLO{}, "", "empty type"},
+		{"tidb:*:p99", LatencySLO{}, "", "bad condition"},
+		{"tidb:*:99<50ms", LatencySLO{}, "", "bad condition"},
+		{"tidb:*:p<50ms", LatencySLO{}, "", "bad condition"},
+		{"tidb:*:pxx<50ms", LatencySLO{}, "", "bad quantile"},
+		{"tidb:*:p1e3<50ms", LatencySLO{}, "", "bad quantile"},
+		{"tidb:*:p0<50ms", LatencySLO{}, "", "bad quantile"},
+		{"tidb:*:p99<50", LatencySLO{}, "", "missing unit"},
+		{"tidb:*:p99<0s", LatencySLO{}, "", "should be positive"},
+		{"tidb:*:p99<-1s", LatencySLO{}, "", "should be positive"},
+	}
+
+	for _, c := range cases {
+		slo, err := ParseLatencySLO(c.spec)
+		if len(c.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error '%s', got: %v", c.spec, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.spec, err)
+			continue
+		}
+		if slo != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.spec, c.expected, slo)
+		}
+		if slo.QuantileName() != c.quantile {
+			t.Errorf("%s: expected quantile name %s, got %s", c.spec, c.quantile, slo.QuantileName())
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package base
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Span is a continuous time range in which a series keeps matching a condition
+type Span struct {
+	Start  time.Time
+	End    time.Time
+	Max    float64
+	Avg    float64
+	Metric model.Metric
+}
+
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+func (s Span) Overlaps(start time.Time, end time.Time) bool {
+	return !s.End.Before(start) && !s.Start.After(end)
+}
+
+// A span ends at the first not matched sample, or at the last sample if it's still matching
+func FindSpans(vector CollectedSourceTasks, match func(v float64) bool, minDuration time.Duration) (spans []Span) {
+	var curr *Span
+	count := 0
+	sum := float64(0)
+	closeSpan := func(end model.Time) {
+		curr.End = Ms2Time(end)
+		curr.Avg = sum / float64(count)
+		if curr.Duration() >= minDuration {
+			spans = append(spans, *curr)
+		}
+		curr = nil
+	}
+
+	for _, pair := range vector.Pairs {
+		value := float64(pair.Value)
+		if !match(value) {
+			if curr != nil {
+				closeSpan(pair.Timestamp)
+			}
+			continue
+		}
+		if curr == nil {
+			curr = &Span{Ms2Time(pair.Timestamp), Ms2Time(pair.Timestamp), value, 0, vector.Metric}
+			count = 0
+			sum = 0
+		}
+		if value > curr.Max {
+			curr.Max = value
+		}
+		count += 1
+		sum += value
+	}
+	if curr != nil {
+		closeSpan(vector.Pairs[len(vector.Pairs)-1].Timestamp)
+	}
+	return
+}
+
+func FindSpansAbove(vector CollectedSourceTasks, threshold float64, minDuration time.Duration) []Span {
+	return FindSpans(vector, func(v float64) bool {
+		return v > threshold
+	}, minDuration)
+}
+
+// Return the max value and the average value of the samples in [start, end], NaN values are skipped
+func StatsInRange(vector CollectedSourceTasks, start time.Time, end time.Time) (max float64, avg float64, ok bool) {
+	count := 0
+	sum := float64(0)
+	for _, pair := range vector.Pairs {
+		t := Ms2Time(pair.Timestamp)
+		if t.Before(start) || t.After(end) {
+			continue
+		}
+		value := float64(pair.Value)
+		if math.IsNaN(value) {
+			continue
+		}
+		if count == 0 || value > max {
+			max = value
+		}
+		count += 1
+		sum += value
+	}
+	if count == 0 {
+		return
+	}
+	return max, sum / float64(count), true
+}
+
+// Return the median of the samples out of [start, end], NaN values are skipped
+func MedianOutOfRange(vector CollectedSourceTasks, start time.Time, end time.Time) (median float64, ok bool) {
+	var values []float64
+	for _, pair := range vector.Pairs {
+		t := Ms2Time(pair.Timestamp)
+		if !t.Before(start) && !t.After(end) {
+			continue
+		}
+		value := float64(pair.Value)
+		if math.IsNaN(value) {
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return
+	}
+	sort.Float64s(values)
+	if len(values)%2 == 1 {
+		return values[len(values)/2], true
+	}
+	return (values[len(values)/2-1] + values[len(values)/2]) / 2, true
+}
@@ -2,6 +2,8 @@ package base
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -20,54 +22,202 @@ func (t TimeRange) String() string {
 	return fmt.Sprintf("%s => %s", t.From.Format(TimeFormat), t.To.Format(TimeFormat))
 }
 
-func NewTimeRangeFromArgs(from string, to string, duration time.Duration) (t TimeRange, err error) {
+func NewTimeRangeFromArgs(from string, to string, duration time.Duration) (TimeRange, error) {
+	return NewTimeRangeFromArgsAt(from, to, duration, Now())
+}
+
+// The combinations: 'from + to' is the specified range; 'from + duration' is cut at now;
+// 'from' ends at now; 'duration' ends at now; 'to + duration' ends at 'to';
+// 'to' or none means auto detecting the range end at 'to' or now, the returned range is not valid.
+func NewTimeRangeFromArgsAt(from string, to string, duration time.Duration, now time.Time) (t TimeRange, err error) {
+	if duration < 0 {
+		err = fmt.Errorf("the time arg `duration` should not be negative: %v", duration)
+		return
+	}
 	if len(from) != 0 {
-		t.From, err = time.Parse(TimeFormatZ, from+" CST")
+		t.From, err = ParseTimeArg(from, now)
 		if err != nil {
 			return
 		}
+		if t.From.After(now) {
+			err = fmt.Errorf("the time arg `from` after `now`: %s vs %s",
+				t.From.Format(TimeFormatZ), now.Format(TimeFormatZ))
+			return
+		}
 	}
 	if len(to) != 0 {
-		t.To, err = time.Parse(TimeFormatZ, to+" CST")
+		t.To, err = ParseTimeArg(to, now)
 		if err != nil {
 			return
 		}
+		if t.To.After(now) {
+			err = fmt.Errorf("the time arg `to` after `now`: %s vs %s",
+				t.To.Format(TimeFormatZ), now.Format(TimeFormatZ))
+			return
+		}
 	}
-	if t.Valid() {
-		if t.From.After(t.To) {
-			t.From, t.To = t.To, t.From
+
+	hasFrom := !t.From.IsZero()
+	hasTo := !t.To.IsZero()
+	hasDuration := duration != 0
+
+	switch {
+	case hasFrom && hasTo && hasDuration:
+		err = fmt.Errorf("the time args `from`, `to` and `duration` should not be all specified")
+		return
+	case hasFrom && hasTo:
+	case hasFrom && hasDuration:
+		t.To = t.From.Add(duration)
+		if t.To.After(now) {
+			t.To = now
 		}
+	case hasTo && hasDuration:
+		t.From = t.To.Add(-duration)
+	case hasFrom:
+		t.To = now
+	case hasTo:
 		return
+	case hasDuration:
+		t.To = now
+		t.From = t.To.Add(-duration)
+	default:
+		return
+	}
+
+	if t.From.After(t.To) {
+		err = fmt.Errorf("the time range is inverted: %s", t)
+	} else if !t.From.Before(t.To) {
+		err = fmt.Errorf("the time range is empty: %s", t)
+	}
+	return
+}
+
+// All times are rendered in this location
+var Location = time.Local
+
+// The name could be: Local, UTC, an IANA name like Asia/Shanghai, or an offset like +08:00
+func SetLocation(name string) (err error) {
+	Location, err = LoadLocation(name)
+	return
+}
+
+func LoadLocation(name string) (*time.Location, error) {
+	if len(name) != 0 && (name[0] == '+' || name[0] == '-') {
+		offset, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, fmt.Errorf("bad time zone offset: '" + name + "', should be like: +08:00")
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(name, seconds), nil
+	}
+	return time.LoadLocation(name)
+}
+
+func Now() time.Time {
+	return time.Now().In(Location)
+}
+
+// Absolute formats: '2006-01-02 15:04:05', '2006-01-02 15:04', '2006-01-02', RFC3339, epoch seconds or milliseconds.
+// Relative formats: 'now', 'now-6h', 'today 14:00', 'yesterday 14:00'.
+// An offset suffix is allowed: '2020-04-20 05:00 +2h', 'yesterday -30m'.
+// The time is in Location if the zone is not specified.
+func ParseTimeArg(arg string, now time.Time) (t time.Time, err error) {
+	arg = strings.TrimSpace(arg)
+	now = now.In(Location)
+
+	var offset time.Duration
+	if i := strings.LastIndex(arg, " "); i > 0 {
+		suffix := arg[i+1:]
+		if suffix[0] == '+' || suffix[0] == '-' {
+			offset, err = time.ParseDuration(suffix)
+			if err != nil {
+				err = fmt.Errorf("bad time offset '%s' in '%s'", suffix, arg)
+				return
+			}
+			arg = strings.TrimSpace(arg[:i])
+		}
 	}
-	if duration == 0 {
+
+	t, err = parseTimeBase(arg, now)
+	if err != nil {
 		return
 	}
+	return t.Add(offset).In(Location), nil
+}
 
-	now := time.Now()
-	if !t.Valid() {
-		t.To = now
-		t.From = t.To.Add(-duration)
-	} else if t.To.IsZero() {
-		if t.From.After(now) {
-			err = fmt.Errorf("the time arg `from` after `now`: %s vs %s",
-				t.From.Format(TimeFormatZ), now.Format(TimeFormatZ))
+func parseTimeBase(arg string, now time.Time) (t time.Time, err error) {
+	if strings.HasPrefix(arg, "now") {
+		if arg == "now" {
+			return now, nil
+		}
+		var offset time.Duration
+		offset, err = time.ParseDuration(arg[len("now"):])
+		if err != nil {
+			err = fmt.Errorf("bad relative time: '" + arg + "', should be like: now-6h")
 			return
 		}
-		t.To = t.From.Add(duration)
-		if t.To.After(now) {
-			t.To = now
+		return now.Add(offset), nil
+	}
+
+	for _, day := range []struct {
+		name string
+		days int
+	}{{"today", 0}, {"yesterday", -1}} {
+		if !strings.HasPrefix(arg, day.name) {
+			continue
 		}
-	} else {
-		if t.To.After(now) {
-			t.To = now
+		date := now.AddDate(0, 0, day.days).Format("2006-01-02")
+		clock := strings.TrimSpace(arg[len(day.name):])
+		if len(clock) == 0 {
+			clock = "00:00"
 		}
-		t.From = t.To.Add(-duration)
+		return parseTimeBase(date+" "+clock, now)
 	}
+
+	if isDigits(arg) {
+		var epoch int64
+		epoch, err = strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return
+		}
+		// Larger than the seconds of year 5138, should be milliseconds
+		if epoch > 1e11 {
+			return time.Unix(0, epoch*int64(time.Millisecond)), nil
+		}
+		return time.Unix(epoch, 0), nil
+	}
+
+	if t, err = time.Parse(time.RFC3339, arg); err == nil {
+		return
+	}
+	for _, layout := range []string{TimeFormat, "2006-01-02 15:04", "2006-01-02 15", "2006-01-02", "15:04:05", "15:04"} {
+		t, err = time.ParseInLocation(layout, arg, Location)
+		if err != nil {
+			continue
+		}
+		if layout == "15:04:05" || layout == "15:04" {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, Location)
+		}
+		return
+	}
+	err = fmt.Errorf("unknown time format: '" + arg + "', should be like: '2006-01-02 15:04:05', RFC3339, epoch, 'now-6h', 'yesterday 14:00'")
 	return
 }
 
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func Ms2Time(ms model.Time) time.Time {
-	return time.Unix(0, int64(1e6*ms))
+	return time.Unix(0, int64(1e6*ms)).In(Location)
 }
 
 func Time2Ms(t time.Time) model.Time {
@@ -0,0 +1,181 @@
+package base
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeArg(t *testing.T) {
+	defer func(location *time.Location) {
+		Location = location
+	}(Location)
+	Location = time.FixedZone("+08:00", 8*3600)
+
+	at := func(s string) time.Time {
+		parsed, err := time.ParseInLocation(TimeFormat, s, Location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	now := at("2020-04-20 12:30:00")
+
+	cases := []struct {
+		arg      string
+		expected time.Time
+		err      string
+	}{
+		{"now", now, ""},
+		{"now-6h", at("2020-04-20 06:30:00"), ""},
+		{"now+30m", at("2020-04-20 13:00:00"), ""},
+		{"now-6x", time.Time{}, "bad relative time"},
+		{"today", at("2020-04-20 00:00:00"), ""},
+		{"today 14:00", at("2020-04-20 14:00:00"), ""},
+		{"yesterday 14:00", at("2020-04-19 14:00:00"), ""},
+		{"yesterday -30m", at("2020-04-18 23:30:00"), ""},
+		{"1587357000", at("2020-04-20 12:30:00"), ""},
+		{"1587357000123", at("2020-04-20 12:30:00").Add(123 * time.Millisecond), ""},
+		{"2020-04-20T04:30:00Z", at("2020-04-20 12:30:00"), ""},
+		{"2020-04-20T10:30:00+06:00", at("2020-04-20 12:30:00"), ""},
+		{"2020-04-20 05:00:01", at("2020-04-20 05:00:01"), ""},
+		{"2020-04-20 05:00", at("2020-04-20 05:00:00"), ""},
+		{"2020-04-20 05", at("2020-04-20 05:00:00"), ""},
+		{"2020-04-20", at("2020-04-20 00:00:00"), ""},
+		{"08:15:30", at("2020-04-20 08:15:30"), ""},
+		{"08:15", at("2020-04-20 08:15:00"), ""},
+		{"  2020-04-20 05:00  ", at("2020-04-20 05:00:00"), ""},
+		{"2020-04-20 05:00 +2h", at("2020-04-20 07:00:00"), ""},
+		{"2020-04-20 -1h30m", at("2020-04-19 22:30:00"), ""},
+		{"2020-04-20 05:00 +2x", time.Time{}, "bad time offset"},
+		{"2020/04/20", time.Time{}, "unknown time format"},
+		{"tomorrow", time.Time{}, "unknown time format"},
+	}
+
+	for _, c := range cases {
+		result, err := ParseTimeArg(c.arg, now)
+		if len(c.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("'%s': expected error '%s', got: %v", c.arg, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("'%s': unexpected error: %v", c.arg, err)
+			continue
+		}
+		if !result.Equal(c.expected) {
+			t.Errorf("'%s': expected %v, got %v", c.arg, c.expected, result)
+		}
+		if result.Location() != Location {
+			t.Errorf("'%s': expected in %v, got %v", c.arg, Location, result.Location())
+		}
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	cases := []struct {
+		name   string
+		offset int
+		err    string
+	}{
+		{"UTC", 0, ""},
+		{"+08:00", 8 * 3600, ""},
+		{"-05:30", -(5*3600 + 30*60), ""},
+		{"+8", 0, "bad time zone offset"},
+		{"+08:xx", 0, "bad time zone offset"},
+		{"Nowhere/City", 0, "unknown time zone"},
+	}
+	for _, c := range cases {
+		location, err := LoadLocation(c.name)
+		if len(c.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("'%s': expected error '%s', got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("'%s': unexpected error: %v", c.name, err)
+			continue
+		}
+		_, offset := time.Date(2020, 1, 1, 0, 0, 0, 0, location).Zone()
+		if offset != c.offset {
+			t.Errorf("'%s': expected offset %d, got %d", c.name, c.offset, offset)
+		}
+	}
+}
+
+func TestNewTimeRangeFromArgsAt(t *testing.T) {
+	defer func(location *time.Location) {
+		Location = location
+	}(Location)
+	Location = time.UTC
+
+	at := func(s string) time.Time {
+		parsed, err := time.ParseInLocation(TimeFormat, s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	now := at("2020-04-20 12:00:00")
+
+	cases := []struct {
+		name     string
+		from     string
+		to       string
+		duration time.Duration
+		expected TimeRange
+		err      string
+	}{
+		{"from and to", "2020-04-20 10:00:00", "2020-04-20 11:00:00", 0,
+			TimeRange{at("2020-04-20 10:00:00"), at("2020-04-20 11:00:00")}, ""},
+		{"from and duration", "2020-04-20 10:00:00", "", 30 * time.Minute,
+			TimeRange{at("2020-04-20 10:00:00"), at("2020-04-20 10:30:00")}, ""},
+		{"from and duration cut at now", "2020-04-20 10:00:00", "", 6 * time.Hour,
+			TimeRange{at("2020-04-20 10:00:00"), now}, ""},
+		{"to and duration", "", "2020-04-20 11:00:00", time.Hour,
+			TimeRange{at("2020-04-20 10:00:00"), at("2020-04-20 11:00:00")}, ""},
+		{"from only", "now-6h", "", 0,
+			TimeRange{at("2020-04-20 06:00:00"), now}, ""},
+		{"to only", "", "2020-04-20 11:00:00", 0,
+			TimeRange{time.Time{}, at("2020-04-20 11:00:00")}, ""},
+		{"duration only", "", "", 2 * time.Hour,
+			TimeRange{at("2020-04-20 10:00:00"), now}, ""},
+		{"none", "", "", 0,
+			TimeRange{}, ""},
+		{"to after now", "", "2020-04-20 13:00:00", 0,
+			TimeRange{}, "`to` after `now`"},
+		{"from after now", "2020-04-20 13:00:00", "", 0,
+			TimeRange{}, "`from` after `now`"},
+		{"empty", "2020-04-20 10:00:00", "2020-04-20 10:00:00", 0,
+			TimeRange{}, "empty"},
+		{"inverted", "2020-04-20 11:00:00", "2020-04-20 10:00:00", 0,
+			TimeRange{}, "inverted"},
+		{"all specified", "2020-04-20 10:00:00", "2020-04-20 11:00:00", time.Hour,
+			TimeRange{}, "should not be all specified"},
+		{"negative duration", "", "", -time.Hour,
+			TimeRange{}, "negative"},
+	}
+
+	for _, c := range cases {
+		result, err := NewTimeRangeFromArgsAt(c.from, c.to, c.duration, now)
+		if len(c.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error '%s', got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !result.From.Equal(c.expected.From) || !result.To.Equal(c.expected.To) {
+			t.Errorf("%s: expected %v => %v, got %v => %v", c.name,
+				c.expected.From, c.expected.To, result.From, result.To)
+		}
+		if result.Valid() != (!c.expected.From.IsZero() && !c.expected.To.IsZero()) {
+			t.Errorf("%s: unexpected valid: %v", c.name, result.Valid())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package apa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+func (a *AutoPerfAssistant) DoCapacity(threshold time.Duration) (err error) {
+	periods, err := a.DetectPeriods()
+	err = a.checkPartial(err, "")
+	if err != nil {
+		return
+	}
+
+	var classes []string
+	samples := make(map[string]base.CapacitySamples)
+	for _, period := range base.FlattenPeriods(periods, a.periodLevel) {
+		workload, ok := period.Workload()
+		if !ok || workload.Level() == "inactive" {
+			continue
+		}
+		var vectors []base.CollectedSourceTasks
+		vectors, err = base.CollectSources(a.data, base.GetCapacityLatencySource(), period.Start, period.End, 0)
+		if err != nil {
+			return
+		}
+		if len(vectors) == 0 {
+			continue
+		}
+		_, latency, ok := base.StatsInRange(vectors[0], period.Start, period.End)
+		if !ok {
+			continue
+		}
+
+		read, write := workload.Qps()
+		class := workload.Type()
+		if _, ok := samples[class]; !ok {
+			classes = append(classes, class)
+		}
+		samples[class] = append(samples[class], base.CapacitySample{
+			Period:  period,
+			Qps:     read + write,
+			Latency: time.Duration(latency * float64(time.Second)),
+		})
+	}
+
+	if len(classes) == 0 {
+		a.con.Compact("no active period to estimate capacity\n")
+		return
+	}
+
+	for _, class := range classes {
+		knee := base.EstimateCapacityKnee(class, samples[class], threshold)
+		a.con.Compact(knee, "\n")
+		for _, sample := range knee.Samples {
+			line := fmt.Sprintf("    [%s => %s] %.0f qps, p%v %v", sample.Period.Start.Format(base.TimeFormat),
+				sample.Period.End.Format(base.TimeFormat), sample.Qps, base.CapacityLatencyQuantile*100,
+				sample.Latency.Truncate(time.Millisecond))
+			if knee.Found {
+				line += fmt.Sprintf(", %.0f%% of knee", knee.Usage(sample))
+			}
+			a.con.Detail(line, "\n")
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package chart
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// The sparklines are for the terminal output
+
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Resample the values into the width by averaging, or by stretching if there are fewer values than the width,
+// then scale into the levels from 0 (or the negative min) to the max.
+// The NaN values are skipped, a bucket without values is a space.
+func Sparkline(values []float64, width int) string {
+	if width <= 0 || len(values) == 0 {
+		return ""
+	}
+	buckets := make([]float64, width)
+	for i := range buckets {
+		from := i * len(values) / width
+		to := (i + 1) * len(values) / width
+		if to <= from {
+			to = from + 1
+		}
+		sum := 0.0
+		count := 0
+		for _, v := range values[from:to] {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			sum += v
+			count += 1
+		}
+		if count == 0 {
+			buckets[i] = math.NaN()
+		} else {
+			buckets[i] = sum / float64(count)
+		}
+	}
+
+	min, max := 0.0, math.Inf(-1)
+	for _, v := range buckets {
+		if !math.IsNaN(v) {
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+	}
+	b := strings.Builder{}
+	for _, v := range buckets {
+		if math.IsNaN(v) {
+			b.WriteRune(' ')
+			continue
+		}
+		level := 0
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(sparkLevels)-1))
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// A strip of the range, the boundaries are marked
+func Strip(start time.Time, end time.Time, boundaries []time.Time, width int) string {
+	if width < 2 {
+		return ""
+	}
+	strip := []rune(strings.Repeat("─", width))
+	strip[0] = '├'
+	strip[width-1] = '┤'
+	total := end.Sub(start)
+	if total <= 0 {
+		return string(strip)
+	}
+	for _, boundary := range boundaries {
+		if boundary.Before(start) || boundary.After(end) {
+			continue
+		}
+		i := int(float64(boundary.Sub(start)) / float64(total) * float64(width-1))
+		if i > 0 && i < width-1 {
+			strip[i] = '┼'
+		}
+	}
+	return string(strip)
+}
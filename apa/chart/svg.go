@@ -0,0 +1,226 @@
+package chart
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"time"
+)
+
+// The charts are rendered as inline svg, no scripts or external assets are needed
+
+type Series struct {
+	Name   string
+	Times  []time.Time
+	Values []float64
+}
+
+// A vertical line at a time, the label is shown as tooltip
+type Marker struct {
+	At    time.Time
+	Label string
+	Color string
+}
+
+// A time span with a label, for the period timeline
+type Span struct {
+	Start time.Time
+	End   time.Time
+	Label string
+}
+
+// A stacked bar, the parts are in the same order in all bars
+type Bar struct {
+	Label  string
+	Values []float64
+}
+
+var Palette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+const (
+	Width        = 960
+	Height       = 220
+	marginLeft   = 70
+	marginRight  = 10
+	marginTop    = 24
+	marginBottom = 24
+)
+
+type frame struct {
+	start time.Time
+	end   time.Time
+	max   float64
+}
+
+func (f frame) x(t time.Time) float64 {
+	total := f.end.Sub(f.start)
+	if total <= 0 {
+		return marginLeft
+	}
+	return marginLeft + float64(Width-marginLeft-marginRight)*float64(t.Sub(f.start))/float64(total)
+}
+
+func (f frame) y(v float64) float64 {
+	if f.max <= 0 {
+		return Height - marginBottom
+	}
+	return Height - marginBottom - float64(Height-marginTop-marginBottom)*v/f.max
+}
+
+// The NaN values break the line
+func LineChart(title string, series []Series, start time.Time, end time.Time, markers []Marker,
+	format func(float64) string) string {
+
+	f := frame{start, end, 0}
+	for _, it := range series {
+		for _, v := range it.Values {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) && v > f.max {
+				f.max = v
+			}
+		}
+	}
+
+	b := &strings.Builder{}
+	header(b, title, Height)
+	axis(b, f, format)
+	for i, it := range series {
+		color := Palette[i%len(Palette)]
+		var points []string
+		flush := func() {
+			if len(points) != 0 {
+				fmt.Fprintf(b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"><title>%s</title></polyline>`,
+					color, strings.Join(points, " "), html.EscapeString(it.Name))
+				points = nil
+			}
+		}
+		for j, v := range it.Values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				flush()
+				continue
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", f.x(it.Times[j]), f.y(v)))
+		}
+		flush()
+	}
+	drawMarkers(b, f, markers)
+	legend(b, series)
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// The spans are drawn in turns of colors, with the labels inside if there is enough room
+func Timeline(spans []Span, start time.Time, end time.Time, markers []Marker) string {
+	const height = 70
+	f := frame{start, end, 0}
+	b := &strings.Builder{}
+	header(b, "Periods", height)
+	for i, span := range spans {
+		x0 := f.x(span.Start)
+		x1 := f.x(span.End)
+		fmt.Fprintf(b, `<rect x="%.1f" y="%d" width="%.1f" height="30" fill="%s" opacity="0.6"><title>%s</title></rect>`,
+			x0, marginTop, math.Max(x1-x0, 1), Palette[i%len(Palette)], html.EscapeString(span.Label))
+		if x1-x0 > float64(len(span.Label))*6 {
+			fmt.Fprintf(b, `<text x="%.1f" y="%d" font-size="11">%s</text>`, x0+3, marginTop+19, html.EscapeString(span.Label))
+		}
+	}
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="10">%s</text>`, marginLeft, height-4, start.Format("2006-01-02 15:04"))
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="10" text-anchor="end">%s</text>`, Width-marginRight, height-4, end.Format("2006-01-02 15:04"))
+	for _, marker := range markers {
+		x := f.x(marker.At)
+		fmt.Fprintf(b, `<path d="M%.1f %d l-4 -7 h8 z" fill="%s"><title>%s</title></path>`,
+			x, marginTop, marker.Color, html.EscapeString(marker.Label))
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// The names are the parts of each bar, the values without names are drawn unnamed
+func StackedBars(title string, names []string, bars []Bar, format func(float64) string) string {
+	f := frame{max: 0}
+	for _, bar := range bars {
+		sum := 0.0
+		for _, v := range bar.Values {
+			sum += v
+		}
+		f.max = math.Max(f.max, sum)
+	}
+
+	b := &strings.Builder{}
+	header(b, title, Height)
+	grid(b, f, format)
+	if len(bars) != 0 {
+		slot := float64(Width-marginLeft-marginRight) / float64(len(bars))
+		width := math.Max(math.Min(slot*0.7, 60), 1)
+		for i, bar := range bars {
+			x := marginLeft + slot*float64(i) + (slot-width)/2
+			base := 0.0
+			for j, v := range bar.Values {
+				if v <= 0 || math.IsNaN(v) {
+					continue
+				}
+				name := ""
+				if j < len(names) {
+					name = names[j]
+				}
+				y0 := f.y(base)
+				y1 := f.y(base + v)
+				fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+					x, y1, width, y0-y1, Palette[j%len(Palette)], html.EscapeString(name), format(v))
+				base += v
+			}
+			fmt.Fprintf(b, `<text x="%.1f" y="%d" font-size="10" text-anchor="middle">%s</text>`,
+				x+width/2, Height-8, html.EscapeString(bar.Label))
+		}
+	}
+	var series []Series
+	for _, name := range names {
+		series = append(series, Series{Name: name})
+	}
+	legend(b, series)
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+func header(b *strings.Builder, title string, height int) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`,
+		Width, height, Width, height)
+	fmt.Fprintf(b, `<text x="%d" y="14" font-size="13" font-weight="bold">%s</text>`, marginLeft, html.EscapeString(title))
+}
+
+func grid(b *strings.Builder, f frame, format func(float64) string) {
+	const lines = 4
+	for i := 0; i <= lines; i++ {
+		v := f.max * float64(i) / lines
+		y := f.y(v)
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`, marginLeft, y, Width-marginRight, y)
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" font-size="10" text-anchor="end">%s</text>`, marginLeft-4, y+3, html.EscapeString(format(v)))
+	}
+}
+
+func axis(b *strings.Builder, f frame, format func(float64) string) {
+	grid(b, f, format)
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="10">%s</text>`, marginLeft, Height-8, f.start.Format("2006-01-02 15:04"))
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="10" text-anchor="end">%s</text>`, Width-marginRight, Height-8, f.end.Format("2006-01-02 15:04"))
+}
+
+func drawMarkers(b *strings.Builder, f frame, markers []Marker) {
+	for _, marker := range markers {
+		x := f.x(marker.At)
+		fmt.Fprintf(b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="%s" stroke-dasharray="3,3"><title>%s</title></line>`,
+			x, marginTop, x, Height-marginBottom, marker.Color, html.EscapeString(marker.Label))
+	}
+}
+
+func legend(b *strings.Builder, series []Series) {
+	x := Width - marginRight
+	for i := len(series) - 1; i >= 0; i-- {
+		name := series[i].Name
+		x -= len(name)*6 + 18
+		fmt.Fprintf(b, `<rect x="%d" y="5" width="10" height="10" fill="%s"/>`, x, Palette[i%len(Palette)])
+		fmt.Fprintf(b, `<text x="%d" y="14" font-size="10">%s</text>`, x+13, html.EscapeString(name))
+	}
+}
@@ -15,7 +15,11 @@ func DetectAlive(data sources.Sources, period base.Period, found FoundEvents, co
 		return
 	}
 	for _, vector := range vectors {
-		points := base.FindBreakingPoints(vector)
+		var points []base.BreakingPoint
+		points, err = base.FindBreakingPoints(vector)
+		if err != nil {
+			return
+		}
 		for _, point := range points {
 			info := AliveInfo{
 				string(point.Metric["instance"]),
@@ -34,6 +38,13 @@ type AliveInfo struct {
 	IsUpping bool
 }
 
+func (a AliveInfo) Correlation() CorrelationInfo {
+	if a.IsUpping {
+		return CorrelationInfo{a.Type + " up", 0, []string{a.Instance}, CorrelationWeightMedium}
+	}
+	return CorrelationInfo{a.Type + " down", 0, []string{a.Instance}, CorrelationWeightRoot}
+}
+
 func (a AliveInfo) Output(when time.Time, con base.Console, indent string) {
 	var action string
 	if a.IsUpping {
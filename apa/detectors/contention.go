@@ -0,0 +1,96 @@
+package detectors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+func DetectContention(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+	vectors, err := base.CollectSources(data, base.GetContentionSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+
+	thresholds := make(map[string]base.ContentionSignal)
+	for _, signal := range base.TiDBContentionSignals {
+		thresholds[signal.Name] = signal
+	}
+
+	var spans []base.Span
+	for _, vector := range vectors {
+		signal, ok := thresholds[string(vector.Metric["signal"])]
+		if !ok {
+			continue
+		}
+		spans = append(spans, base.FindSpansAbove(vector, signal.Threshold, base.ContentionMinDuration)...)
+	}
+	if len(spans) == 0 {
+		return
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+
+	writeType := ""
+	if workload, ok := period.Workload(); ok {
+		writeType = workload.WriteType()
+	}
+
+	// Merge the overlapped spans of different signals into one contention event
+	var info *ContentionInfo
+	var start, end time.Time
+	for _, span := range spans {
+		if info != nil && !span.Start.After(end) {
+			if span.End.After(end) {
+				end = span.End
+			}
+		} else {
+			if info != nil {
+				info.Duration = end.Sub(start)
+				events = append(events, Event{start, *info})
+			}
+			info = &ContentionInfo{WriteType: writeType}
+			start = span.Start
+			end = span.End
+		}
+		signal := thresholds[string(span.Metric["signal"])]
+		info.Signals = append(info.Signals, ContentionPeak{signal.Desc, signal.Unit, span.Max})
+	}
+	info.Duration = end.Sub(start)
+	events = append(events, Event{start, *info})
+	return
+}
+
+type ContentionPeak struct {
+	Desc  string
+	Unit  string
+	Value float64
+}
+
+type ContentionInfo struct {
+	Duration  time.Duration
+	Signals   []ContentionPeak
+	WriteType string
+}
+
+func (c ContentionInfo) Correlation() CorrelationInfo {
+	return CorrelationInfo{"txn contention", c.Duration, nil, CorrelationWeightLow}
+}
+
+func (c ContentionInfo) Output(when time.Time, con base.Console, indent string) {
+	var signals []string
+	for _, signal := range c.Signals {
+		signals = append(signals, fmt.Sprintf("%s %.2f%s", signal.Desc, signal.Value, signal.Unit))
+	}
+	line := fmt.Sprintf("%s%s [tidb] -> contention for %v: %s", indent, when.Format(base.TimeFormat),
+		c.Duration.Truncate(time.Minute), strings.Join(signals, ", "))
+	if len(c.WriteType) != 0 {
+		line += ", on " + c.WriteType + " workload"
+	}
+	con.Detail(line, "\n")
+}
@@ -0,0 +1,255 @@
+package detectors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+// Optional for an EventInfo, the events not implemented it will not be correlated
+type Correlatable interface {
+	Correlation() CorrelationInfo
+}
+
+// Topology is the instances involved, empty means cluster-wide.
+// Weight is the likelihood of being a root cause, symptoms should have lower weights.
+type CorrelationInfo struct {
+	Kind     string
+	Duration time.Duration
+	Topology []string
+	Weight   int
+}
+
+func (c CorrelationInfo) String() string {
+	if len(c.Topology) == 0 {
+		return c.Kind
+	}
+	return c.Kind + " on " + strings.Join(c.Topology, ",")
+}
+
+const (
+	CorrelationWeightSymptom = 10
+	CorrelationWeightLow     = 40
+	CorrelationWeightMedium  = 60
+	CorrelationWeightHigh    = 80
+	CorrelationWeightRoot    = 100
+)
+
+// A group of related events, ranked by the likelihood of being the root cause
+type Correlation struct {
+	Cause    Event
+	Symptoms Events
+}
+
+func (c Correlation) Score() int {
+	return c.Cause.What.(Correlatable).Correlation().Weight * (len(c.Symptoms) + 1)
+}
+
+func (c Correlation) Output(con base.Console, indent string) {
+	cause := c.Cause.What.(Correlatable).Correlation()
+	var symptoms []string
+	for _, symptom := range c.Symptoms {
+		symptoms = append(symptoms, symptom.What.(Correlatable).Correlation().String())
+	}
+	line := fmt.Sprintf("%s** probable cause: %s at %s, followed by: %s", indent, cause,
+		c.Cause.When.Format(base.TimeFormat), strings.Join(symptoms, ", "))
+	con.Detail(line, "\n")
+}
+
+type Correlations []Correlation
+
+func (c Correlations) Len() int {
+	return len(c)
+}
+
+func (c Correlations) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c Correlations) Less(i, j int) bool {
+	return c[i].Score() > c[j].Score()
+}
+
+// Group the events overlapped in time and topology, then rank the causes in each group.
+// The events on instances are grouped if they share a host. A cluster-wide event joins the group overlapped with it
+// the most, so it won't chain the unrelated groups together, the ones not joined are grouped with each other by time.
+// The events are expected to be sorted by time.
+func Correlate(events Events) (correlations Correlations) {
+	var candidates Events
+	for _, event := range events {
+		if _, ok := event.What.(Correlatable); ok {
+			candidates = append(candidates, event)
+		}
+	}
+
+	groups := make([]int, len(candidates))
+	for i, _ := range groups {
+		groups[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if groups[i] != i {
+			groups[i] = root(groups[i])
+		}
+		return groups[i]
+	}
+	union := func(i int, j int) {
+		groups[root(j)] = root(i)
+	}
+
+	var located, global []int
+	for i, event := range candidates {
+		if len(event.What.(Correlatable).Correlation().Topology) == 0 {
+			global = append(global, i)
+		} else {
+			located = append(located, i)
+		}
+	}
+	for x, i := range located {
+		for _, j := range located[x+1:] {
+			if _, ok := overlapped(candidates[i], candidates[j]); ok && sharedHost(candidates[i], candidates[j]) {
+				union(i, j)
+			}
+		}
+	}
+	var alone []int
+	for _, i := range global {
+		best := -1
+		var bestOverlap time.Duration
+		for _, j := range located {
+			overlap, ok := overlapped(candidates[i], candidates[j])
+			if ok && (best < 0 || overlap > bestOverlap) {
+				best = j
+				bestOverlap = overlap
+			}
+		}
+		if best >= 0 {
+			union(best, i)
+		} else {
+			alone = append(alone, i)
+		}
+	}
+	for x, i := range alone {
+		for _, j := range alone[x+1:] {
+			if _, ok := overlapped(candidates[i], candidates[j]); ok {
+				union(i, j)
+			}
+		}
+	}
+
+	members := make(map[int]Events)
+	var order []int
+	for i, event := range candidates {
+		r := root(i)
+		if _, ok := members[r]; !ok {
+			order = append(order, r)
+		}
+		members[r] = append(members[r], event)
+	}
+
+	for _, r := range order {
+		group := members[r]
+		if len(group) < 2 {
+			continue
+		}
+		// An event followed by more of the others is more likely the cause, weighted by its own weight.
+		// The earlier one wins if the scores are equal.
+		scores := make(map[int]int)
+		for i, event := range group {
+			followers := 0
+			for j, other := range group {
+				if i != j && !other.When.Before(event.When) {
+					followers += 1
+				}
+			}
+			scores[i] = event.What.(Correlatable).Correlation().Weight * (followers + 1)
+		}
+		indexes := make([]int, len(group))
+		for i, _ := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			si := scores[indexes[i]]
+			sj := scores[indexes[j]]
+			if si != sj {
+				return si > sj
+			}
+			return group[indexes[i]].When.Before(group[indexes[j]].When)
+		})
+		cause := group[indexes[0]]
+		if cause.What.(Correlatable).Correlation().Weight <= CorrelationWeightSymptom {
+			continue
+		}
+		var symptoms Events
+		for _, i := range indexes[1:] {
+			symptoms = append(symptoms, group[i])
+		}
+		sort.Sort(symptoms)
+		correlations = append(correlations, Correlation{cause, symptoms})
+	}
+	sort.Stable(correlations)
+	return
+}
+
+// Optional for a Correlatable, the event is active only in these ranges instead of lasting from the event time
+type Spanned interface {
+	ActiveRanges() []base.TimeRange
+}
+
+// The active ranges of the event, extended by the slack
+func activeRanges(event Event) (ranges []base.TimeRange) {
+	if spanned, ok := event.What.(Spanned); ok {
+		for _, it := range spanned.ActiveRanges() {
+			ranges = append(ranges, base.TimeRange{From: it.From, To: it.To.Add(base.CorrelationSlack)})
+		}
+	}
+	if len(ranges) == 0 {
+		info := event.What.(Correlatable).Correlation()
+		ranges = append(ranges, base.TimeRange{From: event.When, To: event.When.Add(info.Duration + base.CorrelationSlack)})
+	}
+	return
+}
+
+// The total overlapped duration of the active ranges, ok is false if not overlapped
+func overlapped(a Event, b Event) (overlap time.Duration, ok bool) {
+	for _, x := range activeRanges(a) {
+		for _, y := range activeRanges(b) {
+			if x.To.Before(y.From) || y.To.Before(x.From) {
+				continue
+			}
+			ok = true
+			start := x.From
+			if y.From.After(start) {
+				start = y.From
+			}
+			end := x.To
+			if y.To.Before(end) {
+				end = y.To
+			}
+			overlap += end.Sub(start)
+		}
+	}
+	return
+}
+
+func sharedHost(a Event, b Event) bool {
+	for _, x := range a.What.(Correlatable).Correlation().Topology {
+		for _, y := range b.What.(Correlatable).Correlation().Topology {
+			if hostOf(x) == hostOf(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Different components report different ports of the same host
+func hostOf(instance string) string {
+	if i := strings.LastIndex(instance, ":"); i >= 0 {
+		return instance[:i]
+	}
+	return instance
+}
@@ -0,0 +1,229 @@
+package detectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+// A detector defined in config file, the format is in README
+type CustomDetector struct {
+	Name         string            `json:"name"`
+	Help         string            `json:"help"`
+	Dependencies []string          `json:"dependencies"`
+	Sources      []base.SourceTask `json:"sources"`
+	Condition    CustomCondition   `json:"condition"`
+	Message      string            `json:"message"`
+}
+
+// Types: 'threshold', the value compares to 'value' by 'op' (> or <), lasted at least 'for';
+// 'rate', the changing speed (per minute) is larger than 'value', lasted at least 'for';
+// 'breaking', the value changes, judged by the breaking function of the source
+type CustomCondition struct {
+	Type  string  `json:"type"`
+	Op    string  `json:"op"`
+	Value float64 `json:"value"`
+	For   string  `json:"for"`
+}
+
+func LoadCustomDetectors(path string) (detectors []CustomDetector, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &detectors)
+	if err != nil {
+		err = fmt.Errorf("parsing detectors file %s: %v", path, err)
+		return
+	}
+	for _, it := range detectors {
+		err = it.Validate()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c CustomDetector) Validate() error {
+	if len(c.Name) == 0 || c.Name[0] == '~' {
+		return fmt.Errorf("invalid detector name: '" + c.Name + "'")
+	}
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("detector " + c.Name + " has no sources")
+	}
+	switch c.Condition.Type {
+	case "threshold":
+		if c.Condition.Op != ">" && c.Condition.Op != "<" {
+			return fmt.Errorf("detector " + c.Name + " unknown threshold op: '" + c.Condition.Op + "', should be: >|<")
+		}
+	case "breaking":
+		for _, source := range c.Sources {
+			breaking, err := base.ParseBreaking(source.Function)
+			if err != nil {
+				return fmt.Errorf("detector " + c.Name + " " + err.Error())
+			}
+			if breaking.Group {
+				return fmt.Errorf("detector " + c.Name + " breaking function " + breaking.Name + " can't be used on single vectors")
+			}
+		}
+	case "rate":
+	default:
+		return fmt.Errorf("detector " + c.Name + " unknown condition type: '" + c.Condition.Type +
+			"', should be: threshold|rate|breaking")
+	}
+	if _, err := c.Condition.MinDuration(); err != nil {
+		return fmt.Errorf("detector " + c.Name + " bad condition duration: " + err.Error())
+	}
+	if _, err := template.New(c.Name).Parse(c.Message); err != nil {
+		return fmt.Errorf("detector " + c.Name + " bad message template: " + err.Error())
+	}
+	return nil
+}
+
+func (c CustomCondition) MinDuration() (time.Duration, error) {
+	if len(c.For) == 0 {
+		return 0, nil
+	}
+	return time.ParseDuration(c.For)
+}
+
+func (c CustomDetector) Detector() Detector {
+	return func(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+		vectors, err := base.CollectSources(data, c.Sources, period.Start, period.End, 0)
+		if err != nil {
+			return
+		}
+		message, err := template.New(c.Name).Parse(c.Message)
+		if err != nil {
+			return
+		}
+		minDuration, err := c.Condition.MinDuration()
+		if err != nil {
+			return
+		}
+
+		for _, vector := range vectors {
+			var matches []CustomMatch
+			switch c.Condition.Type {
+			case "threshold":
+				matches = c.matchThreshold(vector, minDuration)
+			case "rate":
+				matches = c.matchRate(vector, minDuration)
+			case "breaking":
+				matches, err = c.matchBreaking(vector)
+				if err != nil {
+					return
+				}
+			}
+			for _, match := range matches {
+				var buf bytes.Buffer
+				err = message.Execute(&buf, match)
+				if err != nil {
+					return
+				}
+				events = append(events, Event{match.When, CustomInfo{c.Name, buf.String(), match}})
+			}
+		}
+		return
+	}
+}
+
+func (c CustomDetector) matchThreshold(vector base.CollectedSourceTasks, minDuration time.Duration) (matches []CustomMatch) {
+	match := func(v float64) bool {
+		return v > c.Condition.Value
+	}
+	if c.Condition.Op == "<" {
+		match = func(v float64) bool {
+			return v < c.Condition.Value
+		}
+	}
+	for _, span := range base.FindSpans(vector, match, minDuration) {
+		matches = append(matches, newCustomMatch(span))
+	}
+	return
+}
+
+// The changing speed of a sample is calculated with the previous sample
+func (c CustomDetector) matchRate(vector base.CollectedSourceTasks, minDuration time.Duration) (matches []CustomMatch) {
+	changes := base.CollectedSourceTasks{Metric: vector.Metric, Source: vector.Source}
+	for i := 1; i < len(vector.Pairs); i++ {
+		prev := vector.Pairs[i-1]
+		curr := vector.Pairs[i]
+		minutes := base.Ms2Time(curr.Timestamp).Sub(base.Ms2Time(prev.Timestamp)).Minutes()
+		if minutes <= 0 {
+			continue
+		}
+		speed := math.Abs(float64(curr.Value-prev.Value)) / minutes
+		changes.Pairs = append(changes.Pairs, model.SamplePair{Timestamp: curr.Timestamp, Value: model.SampleValue(speed)})
+	}
+	for _, span := range base.FindSpansAbove(changes, c.Condition.Value, minDuration) {
+		matches = append(matches, newCustomMatch(span))
+	}
+	return
+}
+
+func (c CustomDetector) matchBreaking(vector base.CollectedSourceTasks) (matches []CustomMatch, err error) {
+	points, err := base.FindBreakingPoints(vector)
+	if err != nil {
+		return
+	}
+	for _, point := range points {
+		matches = append(matches, CustomMatch{
+			When:   base.Ms2Time(point.Point),
+			Metric: metricLabels(point.Metric),
+			Prev:   float64(point.Prev.Value),
+			Curr:   float64(point.Curr.Value),
+		})
+	}
+	return
+}
+
+func newCustomMatch(span base.Span) CustomMatch {
+	return CustomMatch{
+		When:     span.Start,
+		Metric:   metricLabels(span.Metric),
+		Duration: span.Duration(),
+		Max:      span.Max,
+		Avg:      span.Avg,
+	}
+}
+
+func metricLabels(metric model.Metric) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range metric {
+		labels[string(k)] = string(v)
+	}
+	return labels
+}
+
+// The data could be used in the message template
+type CustomMatch struct {
+	When     time.Time
+	Metric   map[string]string
+	Duration time.Duration
+	Max      float64
+	Avg      float64
+	Prev     float64
+	Curr     float64
+}
+
+type CustomInfo struct {
+	Name    string
+	Message string
+	Match   CustomMatch
+}
+
+func (c CustomInfo) Output(when time.Time, con base.Console, indent string) {
+	line := fmt.Sprintf("%s%s [%s] -> %s", indent, when.Format(base.TimeFormat), c.Name, c.Message)
+	con.Detail(line, "\n")
+}
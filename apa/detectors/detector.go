@@ -1,6 +1,7 @@
 package detectors
 
 import (
+	"sort"
 	"time"
 
 	"github.com/innerr/tiperf/apa/base"
@@ -11,6 +12,15 @@ type Detector func(sources sources.Sources, period base.Period, found FoundEvent
 
 type FoundEvents map[string]Events
 
+// All events sorted by time
+func (f FoundEvents) Events() (events Events) {
+	for _, it := range f {
+		events = append(events, it...)
+	}
+	sort.Sort(events)
+	return
+}
+
 type Events []Event
 
 type Event struct {
@@ -1,6 +1,7 @@
 package detectors
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 
@@ -17,6 +18,9 @@ type Detectors struct {
 	functions     map[string]DetectorFunc
 	workload      map[string]DetectorFunc
 
+	// The settings changing the results, for telling the results apart in history
+	settings []string
+
 	// running status
 	runnings map[string]bool
 	found    FoundEvents
@@ -32,6 +36,7 @@ func NewDetectors() Detectors {
 		make(map[string][]string),
 		make(map[string]DetectorFunc),
 		make(map[string]DetectorFunc),
+		make([]string, 0),
 		make(map[string]bool),
 		make(FoundEvents),
 		make(FoundEvents),
@@ -46,6 +51,45 @@ func (d *Detectors) Register(name string, help string, function Detector, depend
 	d.functions[name] = DetectorFunc{name, dependencies, function}
 }
 
+// Register the detectors defined in the config file, they are also included in 'all'
+func (d *Detectors) RegisterFromFile(path string) (err error) {
+	customs, err := LoadCustomDetectors(path)
+	if err != nil {
+		return
+	}
+	for _, custom := range customs {
+		if _, ok := d.functions[custom.Name]; ok {
+			return fmt.Errorf("detector name conflicted: " + custom.Name)
+		}
+		if _, ok := d.combineds[custom.Name]; ok {
+			return fmt.Errorf("detector name conflicted with combination: " + custom.Name)
+		}
+		help := custom.Help
+		if len(help) == 0 {
+			help = "defined in " + path
+		}
+		dependencies := custom.Dependencies
+		if dependencies == nil {
+			dependencies = []string{}
+		}
+		d.Register(custom.Name, help, custom.Detector(), dependencies)
+		d.combineds["all"] = append(d.combineds["all"], custom.Name)
+	}
+	for _, custom := range customs {
+		for _, dependency := range custom.Dependencies {
+			if _, ok := d.functions[dependency]; !ok {
+				return fmt.Errorf("unknown dependency: " + dependency + " of detector: " + custom.Name)
+			}
+		}
+	}
+	data, err := json.Marshal(customs)
+	if err != nil {
+		return
+	}
+	d.settings = append(d.settings, "detectors: "+string(data))
+	return
+}
+
 func (d *Detectors) RegisterCombined(name string, help string, names []string) {
 	d.combinedNames = append(d.combinedNames, name)
 	d.combinedHelps = append(d.combinedHelps, help)
@@ -63,15 +107,40 @@ func (d *Detectors) RegisterAll() {
 	d.Register("pikes", "detect performance pikes", DetectPikes, []string{"trend"})
 	d.Register("jitter", "detect performance jitter", DetectJitter, []string{"trend"})
 
+	d.Register("stall", "detect tikv write stall and rocksdb pressure", DetectWriteStall, []string{})
+	d.Register("saturation", "detect tikv thread pool saturation", DetectSaturation, []string{})
+	d.Register("contention", "detect txn conflicts and lock contention", DetectContention, []string{})
+	d.Register("hotspot", "detect persistent hot stores and regions", DetectHotspot, []string{})
+	d.Register("scheduling", "detect pd scheduling activity and storms", DetectScheduling, []string{})
+	d.Register("slo", "detect latency slo breaches", DetectLatencySLO, []string{})
+
 	d.RegisterCombined("all", "detect all", []string{
 		"balance",
 		"trend",
 		"pikes",
 		"alive",
 		"jitter",
+		"stall",
+		"saturation",
+		"contention",
+		"hotspot",
+		"scheduling",
+		"slo",
 	})
 }
 
+// Should be called before parsing workload
+func (d *Detectors) SetLatencySLOs(slos []base.LatencySLO) {
+	function := d.functions["slo"]
+	function.Func = NewLatencySLODetector(slos)
+	d.functions["slo"] = function
+	d.settings = append(d.settings, fmt.Sprintf("slos: %+v", slos))
+}
+
+func (d *Detectors) Settings() []string {
+	return d.settings
+}
+
 func (d *Detectors) HelpStrings() []string {
 	maxNameLen := 0
 	for _, name := range d.names {
@@ -154,23 +223,27 @@ func (d *Detectors) GetWorkload() (workload []string) {
 }
 
 func (d *Detectors) RunWorkload(sources sources.Sources, period base.Period, con base.Console) (events Events, err error) {
+	result, err := d.RunWorkloadByName(sources, period, con)
+	return result.Events(), err
+}
+
+// Same as RunWorkload, but the events are grouped by detector names.
+// If some detectors failed, the result of the others is returned with a partial error.
+func (d *Detectors) RunWorkloadByName(sources sources.Sources, period base.Period, con base.Console) (result FoundEvents, err error) {
+	var partial base.PartialError
 	for name, _ := range d.workload {
-		err = d.run(name, sources, period, con)
-		if err != nil {
-			return
+		runErr := d.run(name, sources, period, con)
+		if runErr != nil {
+			con.Debug("    ## detecting function ", name, " failed\n")
+			partial.Add(base.StepError{Step: "detecting function " + name, Err: runErr})
+			d.runnings = make(map[string]bool)
 		}
 	}
 
-	for _, it := range d.result {
-		events = append(events, it...)
-	}
-	sort.Sort(events)
-
+	result = d.result
 	d.found = FoundEvents{}
 	d.result = FoundEvents{}
-	if len(d.runnings) != 0 {
-		panic("uncleaned running stack")
-	}
+	err = partial.Err()
 	return
 }
 
@@ -0,0 +1,84 @@
+package detectors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+func DetectHotspot(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+	flows, err := base.CollectSources(data, base.GetHotStoreSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	regions, err := base.CollectSources(data, base.GetHotRegionSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	schedules, err := base.CollectSources(data, base.GetHotRegionScheduleSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+
+	for _, flow := range flows {
+		spans := base.FindSpansAbove(flow, base.HotStoreFlowRatio, base.HotStoreMinDuration)
+		for _, span := range spans {
+			info := HotspotInfo{
+				Store:     string(flow.Metric["store"]),
+				Address:   string(flow.Metric["address"]),
+				Kind:      string(flow.Metric["kind"]),
+				Duration:  span.Duration(),
+				FlowRatio: span.Max,
+			}
+			for _, region := range regions {
+				if region.Metric["store"] != flow.Metric["store"] || region.Metric["kind"] != flow.Metric["kind"] {
+					continue
+				}
+				if max, _, ok := base.StatsInRange(region, span.Start, span.End); ok {
+					info.HotRegions = int(max)
+				}
+			}
+			for _, schedule := range schedules {
+				if schedule.Metric["store"] != flow.Metric["store"] || string(schedule.Metric["rw"]) != info.Kind {
+					continue
+				}
+				tp := string(schedule.Metric["type"])
+				if max, _, ok := base.StatsInRange(schedule, span.Start, span.End); ok && max > 0 {
+					info.Scheduled = append(info.Scheduled, tp)
+				}
+			}
+			events = append(events, Event{span.Start, info})
+		}
+	}
+	return
+}
+
+// FlowRatio is the max ratio of the store flow to the average flow of all stores
+type HotspotInfo struct {
+	Store      string
+	Address    string
+	Kind       string
+	Duration   time.Duration
+	FlowRatio  float64
+	HotRegions int
+	Scheduled  []string
+}
+
+func (h HotspotInfo) Correlation() CorrelationInfo {
+	return CorrelationInfo{"hot " + h.Kind + " store", h.Duration, []string{h.Address}, CorrelationWeightMedium}
+}
+
+func (h HotspotInfo) Output(when time.Time, con base.Console, indent string) {
+	line := fmt.Sprintf("%s%s [pd] -> hot %s %s %s for %v, %.1fx average flow, %d hot regions",
+		indent, when.Format(base.TimeFormat), h.Kind, h.Store, h.Address, h.Duration.Truncate(time.Minute),
+		h.FlowRatio, h.HotRegions)
+	con.Detail(line, "\n")
+	if len(h.Scheduled) == 0 {
+		con.Detail(indent, "    ** pd did not move hot regions out of the store\n")
+	} else {
+		con.Detail(indent, "    ** pd moved hot regions out of the store by: ", strings.Join(h.Scheduled, ", "), "\n")
+	}
+}
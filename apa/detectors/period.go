@@ -1,13 +1,56 @@
 package detectors
 
 import (
+	"sort"
 	"time"
 
 	"github.com/innerr/tiperf/apa/base"
 	"github.com/innerr/tiperf/apa/sources"
 )
 
-func DetectWorkloadPeriods(data sources.Sources, period base.Period, con base.Console) (periods []base.Period, err error) {
+// The thresholds produce a tree of periods: the periods detected by the lowest threshold are the coarse ones,
+// each of them is split again by the next higher threshold into its children.
+// Without thresholds, the threshold of the breaking function of the workload source is used, the result has only one level.
+// If the seasonality is valid, the workload changes following the seasonal baseline don't split periods.
+// The workload vectors of the whole range are also returned, aligned by time.
+func DetectWorkloadPeriods(data sources.Sources, period base.Period, seasonality base.Seasonality, con base.Console,
+	thresholds ...float64) (periods []base.Period, workload []base.CollectedSourceTasks, err error) {
+
+	if len(thresholds) == 0 {
+		var threshold float64
+		threshold, err = base.ParseGroupBreakingThreshold(base.GetPeriodWorkloadBreakingPointSource())
+		if err != nil {
+			return
+		}
+		thresholds = []float64{threshold}
+	}
+	sorted := append([]float64{}, thresholds...)
+	sort.Float64s(sorted)
+
+	periods, workload, err = detectWorkloadPeriodsByThreshold(data, period, sorted[0], seasonality, con)
+	if err != nil && !base.IsPartial(err) || len(sorted) == 1 {
+		return
+	}
+
+	var partial base.PartialError
+	partial.Add(err)
+	for i := range periods {
+		children, _, childErr := DetectWorkloadPeriods(data, periods[i], seasonality, con, sorted[1:]...)
+		if childErr != nil {
+			partial.Add(base.StepError{
+				Step: "detect sub-periods in " + periods[i].Start.Format(base.TimeFormat) + " => " + periods[i].End.Format(base.TimeFormat),
+				Err:  childErr,
+			})
+		}
+		periods[i].Children = children
+	}
+	err = partial.Err()
+	return
+}
+
+func detectWorkloadPeriodsByThreshold(data sources.Sources, period base.Period, threshold float64, seasonality base.Seasonality,
+	con base.Console) (periods []base.Period, workload []base.CollectedSourceTasks, err error) {
+
 	// Calculating: smoothen -> locate rough positions -> zoom in to get precise points
 
 	duration := period.End.Sub(period.Start)
@@ -16,18 +59,30 @@ func DetectWorkloadPeriods(data sources.Sources, period base.Period, con base.Co
 	}
 
 	con.Debug("## ", period.Start.Format(base.TimeFormat), " => ",
-		period.End.Format(base.TimeFormat), " detecting worload periods\n")
+		period.End.Format(base.TimeFormat), " detecting worload periods, threshold ", threshold, "\n")
 
 	sources := base.GetPeriodWorkloadBreakingPointSource()
 	step := base.ChooseWorkloadPeriodSmoothStep(duration)
 
-	points, reasons, err := base.CollectPrecisePointsBySimilarity(data, sources, period, step, base.WorkloadPeriodThreshold, 4, con)
-	if err != nil || len(points) <= 2 {
+	points, reasons, gaps, workload, err := base.CollectPrecisePointsBySimilarity(data, sources, period, step, threshold,
+		seasonality, 4, con)
+	if err != nil && !base.IsPartial(err) || len(points) <= 2 {
 		return
 	}
 
 	for i := 1; i < len(points); i++ {
-		periods = append(periods, base.Period{points[i-1], points[i], reasons[i-1], reasons[i]})
+		p := base.Period{
+			Start:       points[i-1],
+			End:         points[i],
+			StartReason: reasons[i-1],
+			EndReason:   reasons[i],
+		}
+		for _, gap := range gaps {
+			if gap.End.After(p.Start) && gap.Start.Before(p.End) {
+				p.Gaps = append(p.Gaps, gap)
+			}
+		}
+		periods = append(periods, p)
 	}
 	return
 }
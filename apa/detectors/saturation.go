@@ -0,0 +1,75 @@
+package detectors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+func DetectSaturation(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+	usages, err := base.CollectSources(data, base.GetThreadPoolUsageSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	sizes, err := base.CollectSources(data, base.GetThreadPoolSizeSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+
+	poolSizes := make(map[string]float64)
+	for _, size := range sizes {
+		max, _, ok := base.StatsInRange(size, period.Start, period.End)
+		if ok {
+			poolSizes[poolKey(size)] = max
+		}
+	}
+
+	for _, usage := range usages {
+		size, ok := poolSizes[poolKey(usage)]
+		if !ok || size == 0 {
+			con.Debug("    ## unknown pool size of ", poolKey(usage), "\n")
+			continue
+		}
+		spans := base.FindSpansAbove(usage, size*base.ThreadPoolSaturatedRatio, base.ThreadPoolSaturatedMinDuration)
+		for _, span := range spans {
+			info := SaturationInfo{
+				string(usage.Metric["instance"]),
+				string(usage.Metric["pool"]),
+				span.Duration(),
+				span.Avg,
+				span.Max,
+				size,
+			}
+			events = append(events, Event{span.Start, info})
+		}
+	}
+	return
+}
+
+func poolKey(vector base.CollectedSourceTasks) string {
+	return string(vector.Metric["instance"]) + "/" + string(vector.Metric["pool"])
+}
+
+// The usage values are in CPU cores, the size is the thread count
+type SaturationInfo struct {
+	Instance string
+	Pool     string
+	Duration time.Duration
+	AvgUsage float64
+	MaxUsage float64
+	Size     float64
+}
+
+func (s SaturationInfo) Correlation() CorrelationInfo {
+	return CorrelationInfo{s.Pool + " saturated", s.Duration, []string{s.Instance}, CorrelationWeightHigh}
+}
+
+func (s SaturationInfo) Output(when time.Time, con base.Console, indent string) {
+	line := fmt.Sprintf("%s%s [tikv] -> %s CPU %.0f%%/%.0f%% for %v on %s",
+		indent, when.Format(base.TimeFormat), s.Pool, s.AvgUsage*100, s.Size*100,
+		s.Duration.Truncate(time.Minute), s.Instance)
+	con.Detail(line, "\n")
+	con.Debug(indent, "    ## max usage ", fmt.Sprintf("%.0f%%", s.MaxUsage*100), "\n")
+}
@@ -0,0 +1,171 @@
+package detectors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+func DetectScheduling(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+	// Look back for the usual rates, so a storm lasting the whole period could still be told
+	lookback := period.Start.Add(-base.SchedulingStormLookback)
+	vectors, err := base.CollectSources(data, base.GetSchedulingSource(), lookback, period.End, 0)
+	if err != nil {
+		return
+	}
+	latencies, err := base.CollectSources(data, base.GetCapacityLatencySource(), lookback, period.End, 0)
+	if err != nil {
+		return
+	}
+
+	duration := period.End.Sub(period.Start)
+	summaries := make(map[string]*OperatorSummary)
+	var stormEvents Events
+
+	for _, vector := range vectors {
+		category := string(vector.Metric["category"])
+		_, avg, ok := base.StatsInRange(vector, period.Start, period.End)
+		if !ok {
+			continue
+		}
+		summary, ok := summaries[category]
+		if !ok {
+			summary = &OperatorSummary{Category: category}
+			summaries[category] = summary
+		}
+
+		total := avg * duration.Seconds()
+		switch string(vector.Metric["event"]) {
+		case "create":
+			summary.Created += total
+			summary.Rate = avg
+		case "finish":
+			summary.Finished += total
+		case "timeout":
+			summary.Timeout += total
+		case "cancel", "replace", "expire":
+			summary.Failed += total
+		default:
+			continue
+		}
+		if string(vector.Metric["event"]) != "create" {
+			continue
+		}
+
+		spans := base.FindSpansAbove(vector, base.SchedulingStormMinRate, base.SchedulingStormMinDuration)
+		for _, span := range spans {
+			if !span.End.After(period.Start) {
+				continue
+			}
+			usual, _ := base.MedianOutOfRange(vector, span.Start, span.End)
+			if span.Avg <= usual*base.SchedulingStormRatio {
+				continue
+			}
+			latency, usualLatency, ok := latencyAround(latencies, span)
+			if !ok || latency < usualLatency*base.SchedulingStormLatencyRatio {
+				continue
+			}
+			info := SchedulingStormInfo{
+				category,
+				span.Duration(),
+				span.Max,
+				usual,
+				span.Avg * span.Duration().Seconds(),
+				latency,
+				usualLatency,
+			}
+			when := span.Start
+			if when.Before(period.Start) {
+				when = period.Start
+			}
+			stormEvents = append(stormEvents, Event{when, info})
+		}
+	}
+
+	info := SchedulingInfo{Duration: duration}
+	for _, category := range base.PDOperatorCategories {
+		summary, ok := summaries[category.Name]
+		if !ok || summary.Created < 1 && summary.Finished < 1 {
+			continue
+		}
+		info.Summaries = append(info.Summaries, *summary)
+	}
+	if len(info.Summaries) != 0 {
+		events = append(events, Event{period.Start, info})
+	}
+	events = append(events, stormEvents...)
+	return
+}
+
+// The totals are estimated from the average rates (per second)
+type OperatorSummary struct {
+	Category string
+	Rate     float64
+	Created  float64
+	Finished float64
+	Timeout  float64
+	Failed   float64
+}
+
+type SchedulingInfo struct {
+	Duration  time.Duration
+	Summaries []OperatorSummary
+}
+
+func (s SchedulingInfo) Output(when time.Time, con base.Console, indent string) {
+	var summaries []string
+	for _, summary := range s.Summaries {
+		line := fmt.Sprintf("%s %.0f (%.1f/min", summary.Category, summary.Created, summary.Rate*60)
+		if summary.Timeout >= 1 {
+			line += fmt.Sprintf(", %.0f timeout", summary.Timeout)
+		}
+		if summary.Failed >= 1 {
+			line += fmt.Sprintf(", %.0f failed", summary.Failed)
+		}
+		summaries = append(summaries, line+")")
+	}
+	line := fmt.Sprintf("%s%s [pd] -> operators in %v: %s", indent, when.Format(base.TimeFormat),
+		s.Duration.Truncate(time.Minute), strings.Join(summaries, ", "))
+	con.Detail(line, "\n")
+}
+
+// Return the max latency from the span start to a while after it ends, and the median latency out of that
+func latencyAround(latencies []base.CollectedSourceTasks, span base.Span) (max float64, usual float64, ok bool) {
+	end := span.End.Add(base.CorrelationSlack)
+	for _, vector := range latencies {
+		if max, _, ok = base.StatsInRange(vector, span.Start, end); !ok {
+			continue
+		}
+		if usual, ok = base.MedianOutOfRange(vector, span.Start, end); ok {
+			return
+		}
+	}
+	return 0, 0, false
+}
+
+// The rates are operators per second and the latencies are in seconds, the usual ones are the medians out of the storm
+type SchedulingStormInfo struct {
+	Category     string
+	Duration     time.Duration
+	PeakRate     float64
+	UsualRate    float64
+	Total        float64
+	Latency      float64
+	UsualLatency float64
+}
+
+func (s SchedulingStormInfo) Correlation() CorrelationInfo {
+	return CorrelationInfo{s.Category + " storm", s.Duration, nil, CorrelationWeightMedium}
+}
+
+func (s SchedulingStormInfo) Output(when time.Time, con base.Console, indent string) {
+	line := fmt.Sprintf("%s%s [pd] -> %s storm for %v, %.0f operators, peak %.1f/min vs usual %.1f/min, "+
+		"p99 latency %v vs usual %v", indent, when.Format(base.TimeFormat), s.Category,
+		s.Duration.Truncate(time.Minute), s.Total, s.PeakRate*60, s.UsualRate*60,
+		time.Duration(s.Latency*float64(time.Second)).Truncate(time.Microsecond),
+		time.Duration(s.UsualLatency*float64(time.Second)).Truncate(time.Microsecond))
+	con.Detail(line, "\n")
+}
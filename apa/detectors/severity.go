@@ -0,0 +1,21 @@
+package detectors
+
+type Severity int
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityMinor:
+		return "minor"
+	case SeverityMajor:
+		return "major"
+	case SeverityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+const (
+	SeverityMinor    Severity = 0
+	SeverityMajor    Severity = 1
+	SeverityCritical Severity = 2
+)
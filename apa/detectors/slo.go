@@ -0,0 +1,87 @@
+package detectors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+func NewLatencySLODetector(slos []base.LatencySLO) Detector {
+	return func(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+		duration := period.End.Sub(period.Start)
+		if duration <= 0 {
+			return
+		}
+		for _, slo := range slos {
+			var vectors []base.CollectedSourceTasks
+			vectors, err = base.CollectSources(data, base.GetLatencySLOSource(slo), period.Start, period.End, 0)
+			if err != nil {
+				return
+			}
+			threshold := slo.Threshold.Seconds()
+			for _, vector := range vectors {
+				spans := base.FindSpansAbove(vector, threshold, 0)
+				if len(spans) == 0 {
+					continue
+				}
+				info := LatencySLOInfo{
+					SLO:    slo,
+					Type:   string(vector.Metric[model.LabelName(slo.TypeLabel())]),
+					Spans:  len(spans),
+					Period: duration,
+				}
+				worst := float64(0)
+				for _, span := range spans {
+					info.Breach += span.Duration()
+					info.Ranges = append(info.Ranges, base.TimeRange{From: span.Start, To: span.End})
+					if span.Max > worst {
+						worst = span.Max
+					}
+				}
+				info.Worst = time.Duration(worst * float64(time.Second))
+				events = append(events, Event{spans[0].Start, info})
+			}
+		}
+		return
+	}
+}
+
+func DetectLatencySLO(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (Events, error) {
+	return NewLatencySLODetector(base.DefaultLatencySLOs())(data, period, found, con)
+}
+
+type LatencySLOInfo struct {
+	SLO    base.LatencySLO
+	Type   string
+	Spans  int
+	Breach time.Duration
+	Period time.Duration
+	Worst  time.Duration
+
+	// The breached spans, the breach is not contiguous
+	Ranges []base.TimeRange
+}
+
+func (l LatencySLOInfo) Correlation() CorrelationInfo {
+	kind := fmt.Sprintf("%s %s %s breach", l.SLO.Component, l.Type, l.SLO.QuantileName())
+	return CorrelationInfo{kind, l.Breach, nil, CorrelationWeightSymptom}
+}
+
+func (l LatencySLOInfo) ActiveRanges() []base.TimeRange {
+	return l.Ranges
+}
+
+func (l LatencySLOInfo) BreachPercent() float64 {
+	return float64(l.Breach) / float64(l.Period) * 100
+}
+
+func (l LatencySLOInfo) Output(when time.Time, con base.Console, indent string) {
+	line := fmt.Sprintf("%s%s [%s] -> %s %s breached slo %v in %d span(s), worst %v, breached %v (%.1f%%)",
+		indent, when.Format(base.TimeFormat), l.SLO.Component, l.Type, l.SLO.QuantileName(), l.SLO.Threshold,
+		l.Spans, l.Worst.Truncate(time.Millisecond), l.Breach.Truncate(time.Second), l.BreachPercent())
+	con.Detail(line, "\n")
+}
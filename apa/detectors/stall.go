@@ -0,0 +1,128 @@
+package detectors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/sources"
+)
+
+func DetectWriteStall(data sources.Sources, period base.Period, found FoundEvents, con base.Console) (events Events, err error) {
+	stalls, err := base.CollectSources(data, base.GetWriteStallSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	reasons, err := base.CollectSources(data, base.GetWriteStallReasonSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	pressures, err := base.CollectSources(data, base.GetWriteStallPressureSource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	reasonsByInstance := groupByLabel(reasons, "instance")
+	pressuresByInstance := groupByLabel(pressures, "instance")
+
+	for _, vector := range stalls {
+		instance := string(vector.Metric["instance"])
+		spans := base.FindSpansAbove(vector, 0, base.WriteStallMinDuration)
+		for _, span := range spans {
+			info := WriteStallInfo{
+				Instance: instance,
+				Duration: span.Duration(),
+				MaxStall: time.Duration(span.Max) * time.Microsecond,
+				Pressure: make(map[string]float64),
+			}
+			for _, pressure := range pressuresByInstance[instance] {
+				max, _, ok := base.StatsInRange(pressure, span.Start, span.End)
+				if ok {
+					info.Pressure[string(pressure.Metric["pressure"])] = max
+				}
+			}
+			info.Trigger = writeStallTrigger(reasonsByInstance[instance], info.Pressure, span)
+			info.Severity = writeStallSeverity(info)
+			events = append(events, Event{span.Start, info})
+		}
+	}
+	return
+}
+
+// Prefer the stall reason reported by rocksdb, guess by the pressure if it's not available
+func writeStallTrigger(reasons []base.CollectedSourceTasks, pressure map[string]float64, span base.Span) string {
+	trigger := ""
+	maxRate := float64(0)
+	for _, reason := range reasons {
+		_, avg, ok := base.StatsInRange(reason, span.Start, span.End)
+		if ok && avg > maxRate {
+			maxRate = avg
+			trigger = string(reason.Metric["type"])
+		}
+	}
+	if len(trigger) != 0 {
+		return trigger
+	}
+
+	limits := map[string]float64{
+		"pending_compaction_bytes": base.WriteStallPendingBytesSlowdown,
+		"level0_files":             base.WriteStallL0FilesSlowdown,
+		"memtables":                base.WriteStallMemtablesSlowdown,
+	}
+	maxRatio := float64(0)
+	for name, limit := range limits {
+		ratio := pressure[name] / limit
+		if ratio >= 1 && ratio > maxRatio {
+			maxRatio = ratio
+			trigger = name
+		}
+	}
+	if len(trigger) == 0 {
+		trigger = "unknown"
+	}
+	return trigger
+}
+
+func writeStallSeverity(info WriteStallInfo) Severity {
+	if strings.HasSuffix(info.Trigger, "_stop") || float64(info.MaxStall/time.Microsecond) >= base.WriteStallMaxCritical {
+		return SeverityCritical
+	}
+	if info.Duration >= base.WriteStallDurationMajor {
+		return SeverityMajor
+	}
+	return SeverityMinor
+}
+
+type WriteStallInfo struct {
+	Instance string
+	Duration time.Duration
+	MaxStall time.Duration
+	Pressure map[string]float64
+	Trigger  string
+	Severity Severity
+}
+
+func (w WriteStallInfo) Correlation() CorrelationInfo {
+	return CorrelationInfo{"write stall", w.Duration, []string{w.Instance}, CorrelationWeightHigh}
+}
+
+func (w WriteStallInfo) Output(when time.Time, con base.Console, indent string) {
+	line := fmt.Sprintf("%s%s [tikv] -> %s write stall %v on %s, max stall %v, trigger: %s",
+		indent, when.Format(base.TimeFormat), w.Severity, w.Duration.Truncate(time.Second), w.Instance,
+		w.MaxStall.Truncate(time.Millisecond), w.Trigger)
+	con.Detail(line, "\n")
+
+	var pressure []string
+	if value, ok := w.Pressure["level0_files"]; ok {
+		pressure = append(pressure, fmt.Sprintf("L0 files %.0f", value))
+	}
+	if value, ok := w.Pressure["pending_compaction_bytes"]; ok {
+		pressure = append(pressure, "pending compaction "+formatBytes(value))
+	}
+	if value, ok := w.Pressure["memtables"]; ok {
+		pressure = append(pressure, fmt.Sprintf("immutable memtables %.0f", value))
+	}
+	if len(pressure) != 0 {
+		con.Debug(indent, "    ## pressure: ", strings.Join(pressure, ", "), "\n")
+	}
+}
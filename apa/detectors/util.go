@@ -1,5 +1,14 @@
 package detectors
 
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
 func padding(s string, max int) string {
 	count := max - len(s)
 	for i := 0; i < count; i++ {
@@ -7,3 +16,30 @@ func padding(s string, max int) string {
 	}
 	return s
 }
+
+func groupByLabel(vectors []base.CollectedSourceTasks, label string) map[string][]base.CollectedSourceTasks {
+	groups := make(map[string][]base.CollectedSourceTasks)
+	for _, vector := range vectors {
+		key := string(vector.Metric[model.LabelName(label)])
+		groups[key] = append(groups[key], vector)
+	}
+	return groups
+}
+
+func sortedKeys(groups map[string][]base.CollectedSourceTasks) (keys []string) {
+	for key, _ := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i += 1
+	}
+	return fmt.Sprintf("%.1f%s", bytes, units[i])
+}
@@ -0,0 +1,53 @@
+package apa
+
+import (
+	"fmt"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/fingerprint"
+)
+
+// Periods are matched with the fingerprints in the library when detecting
+func (a *AutoPerfAssistant) LoadFingerprints(path string) (err error) {
+	a.fingerprints, err = fingerprint.LoadLibrary(path)
+	return
+}
+
+// Add the workload of the analyze range as a fingerprint
+func (a *AutoPerfAssistant) AddFingerprint(name string) error {
+	if !a.timeRange.Valid() {
+		return fmt.Errorf("the time range of the fingerprint should be specified by --from/--to/--duration")
+	}
+	desc, ok, err := base.CollectWorkloadDesc(a.data, a.timeRange.From, a.timeRange.To)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no workload data in " + a.timeRange.String())
+	}
+	fingerprint, err := fingerprint.NewFingerprint(name, desc, a.timeRange.From, a.timeRange.To)
+	if err != nil {
+		return err
+	}
+	a.fingerprints.Add(fingerprint)
+	err = a.fingerprints.Save()
+	if err != nil {
+		return err
+	}
+	a.con.Compact("added ", fingerprint, "\n")
+	return nil
+}
+
+func (a *AutoPerfAssistant) DeleteFingerprint(name string) error {
+	err := a.fingerprints.Delete(name)
+	if err != nil {
+		return err
+	}
+	return a.fingerprints.Save()
+}
+
+func (a *AutoPerfAssistant) ListFingerprints() {
+	for _, it := range a.fingerprints.Fingerprints {
+		a.con.Compact(it, "\n")
+	}
+}
@@ -0,0 +1,139 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+// A named workload, the vector is normalized so only the mix of request types matters
+type Fingerprint struct {
+	Name    string
+	Vec     base.PeriodVec
+	Desc    string
+	From    time.Time
+	To      time.Time
+	Created time.Time
+}
+
+func NewFingerprint(name string, desc base.WorkloadDesc, from time.Time, to time.Time) (fingerprint Fingerprint, err error) {
+	vec, ok := normalize(desc.Vec())
+	if !ok {
+		err = fmt.Errorf("no workload in %s => %s", from.Format(base.TimeFormat), to.Format(base.TimeFormat))
+		return
+	}
+	return Fingerprint{name, vec, desc.String(), from, to, time.Now()}, nil
+}
+
+func (f Fingerprint) String() string {
+	return fmt.Sprintf("%s: %s, from %s => %s", f.Name, f.Desc, f.From.Format(base.TimeFormat), f.To.Format(base.TimeFormat))
+}
+
+type Match struct {
+	Name       string
+	Similarity float64
+}
+
+func (m Match) String() string {
+	return fmt.Sprintf("≈ %s, similarity %.2f", m.Name, m.Similarity)
+}
+
+// The fingerprints are stored in a json file
+type Library struct {
+	path         string
+	Fingerprints []Fingerprint
+}
+
+// Return an empty library if the file not exists
+func LoadLibrary(path string) (library *Library, err error) {
+	library = &Library{path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return library, nil
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &library.Fingerprints)
+	if err != nil {
+		err = fmt.Errorf("parsing fingerprints file %s: %v", path, err)
+	}
+	return
+}
+
+func (l *Library) Save() error {
+	data, err := json.MarshalIndent(l.Fingerprints, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(l.path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(l.path, data, 0644)
+}
+
+// A fingerprint with the same name is replaced
+func (l *Library) Add(fingerprint Fingerprint) {
+	for i, it := range l.Fingerprints {
+		if it.Name == fingerprint.Name {
+			l.Fingerprints[i] = fingerprint
+			return
+		}
+	}
+	l.Fingerprints = append(l.Fingerprints, fingerprint)
+	sort.Slice(l.Fingerprints, func(i, j int) bool {
+		return l.Fingerprints[i].Name < l.Fingerprints[j].Name
+	})
+}
+
+func (l *Library) Delete(name string) error {
+	for i, it := range l.Fingerprints {
+		if it.Name == name {
+			l.Fingerprints = append(l.Fingerprints[:i], l.Fingerprints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("fingerprint not found: " + name)
+}
+
+// Return the most similar fingerprint, ok is false if none of them reached the threshold
+func (l *Library) Match(desc base.WorkloadDesc) (match Match, ok bool) {
+	vec, active := normalize(desc.Vec())
+	if !active {
+		return
+	}
+	for _, it := range l.Fingerprints {
+		similarity := base.CosineSimilarity(vec, it.Vec)
+		if math.IsNaN(similarity) || similarity < base.FingerprintMatchThreshold {
+			continue
+		}
+		if !ok || similarity > match.Similarity {
+			match = Match{it.Name, similarity}
+			ok = true
+		}
+	}
+	return
+}
+
+func normalize(vec base.PeriodVec) (normalized base.PeriodVec, ok bool) {
+	norm := float64(0)
+	for _, it := range vec {
+		norm += it * it
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 || math.IsNaN(norm) {
+		return
+	}
+	for _, it := range vec {
+		normalized = append(normalized, it/norm)
+	}
+	return normalized, true
+}
@@ -0,0 +1,129 @@
+package apa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/detectors"
+	"github.com/innerr/tiperf/apa/grafana"
+)
+
+// Write the annotations into the file ('-' means stdout), and/or post them to the grafana url
+type GrafanaExport struct {
+	Path         string
+	URL          string
+	Token        string
+	DashboardUID string
+	PanelID      int
+	Tags         []string
+}
+
+// Analyze then export the periods and events as grafana annotations
+func (a *AutoPerfAssistant) DoExportGrafana(detector detectors.Detectors, export GrafanaExport) error {
+	if len(export.Path) == 0 && len(export.URL) == 0 {
+		return fmt.Errorf("the output file or the grafana url should be specified")
+	}
+	if export.Path == "-" {
+		a.con = a.con.WithWriter(os.Stderr)
+	}
+	report, err := a.Analyze(&detector)
+	if err != nil {
+		return err
+	}
+	a.checkPartial(report.failed, "")
+	annotations := a.grafanaAnnotations(report, export)
+
+	if len(export.Path) != 0 {
+		data, err := grafana.Marshal(annotations)
+		if err != nil {
+			return err
+		}
+		if export.Path == "-" {
+			fmt.Println(string(data))
+		} else {
+			err = ioutil.WriteFile(export.Path, data, 0644)
+			if err != nil {
+				return err
+			}
+			a.con.Compact(len(annotations), " annotation(s) written to ", export.Path, "\n")
+		}
+	}
+
+	if len(export.URL) != 0 {
+		token := export.Token
+		if len(token) == 0 {
+			token = os.Getenv("GRAFANA_TOKEN")
+		}
+		client := grafana.NewClient(export.URL, token)
+		for i, annotation := range annotations {
+			err = client.Post(annotation)
+			if err != nil {
+				return fmt.Errorf("%d/%d annotation(s) posted: %v", i, len(annotations), err)
+			}
+		}
+		a.con.Compact(len(annotations), " annotation(s) posted to ", export.URL, "\n")
+	}
+	return nil
+}
+
+// The periods are region annotations, the events are point annotations tagged with the detector names.
+// Grafana doesn't deduplicate the posted annotations, all of a run are tagged by the run time for finding and deleting them.
+func (a *AutoPerfAssistant) grafanaAnnotations(report Report, export GrafanaExport) (annotations []grafana.Annotation) {
+	run := grafana.RunTag(time.Now())
+	tags := func(extra ...string) []string {
+		return append(append([]string{"tiperf", run}, export.Tags...), extra...)
+	}
+	add := func(annotation grafana.Annotation) {
+		annotation.DashboardUID = export.DashboardUID
+		annotation.PanelID = export.PanelID
+		annotations = append(annotations, annotation)
+	}
+
+	for _, result := range leafResults(report.Periods) {
+		lines := []string{"workload: " + result.Workload, "started by: " + result.StartReason}
+		periodTags := tags("period")
+		if result.Transition {
+			lines = []string{"transition"}
+			periodTags = tags("period", "transition")
+		} else if result.desc != nil {
+			periodTags = append(periodTags, result.desc.Level())
+		}
+		if result.Fingerprint != nil {
+			lines = append(lines, "fingerprint: "+result.Fingerprint.String())
+		}
+		if len(result.Seasonal) != 0 {
+			lines = append(lines, "seasonal: "+result.Seasonal)
+		}
+		for _, annotation := range result.Annotations {
+			lines = append(lines, "note: "+annotation.Note)
+		}
+		for i, correlation := range result.Correlations {
+			if i >= base.CorrelationMaxShown {
+				break
+			}
+			lines = append(lines, strings.TrimPrefix(firstLine(correlation), "** "))
+		}
+		for _, advice := range result.Advices {
+			lines = append(lines, strings.TrimPrefix(firstLine(advice), "** "))
+		}
+		add(grafana.Annotation{
+			Time:    grafana.Millis(result.Start),
+			TimeEnd: grafana.Millis(result.End),
+			Tags:    periodTags,
+			Text:    strings.Join(lines, "\n"),
+		})
+
+		for _, event := range result.Events {
+			add(grafana.Annotation{
+				Time: grafana.Millis(event.When),
+				Tags: tags("event", event.Detector),
+				Text: event.Desc,
+			})
+		}
+	}
+	return
+}
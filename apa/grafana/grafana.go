@@ -0,0 +1,78 @@
+package grafana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The annotation format of the grafana http api, times are in milliseconds.
+// Without dashboard and panel, it's an organization annotation, shown in the dashboards querying it by tags.
+type Annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd,omitempty"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+func Millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// The tag of all annotations exported in a run
+func RunTag(t time.Time) string {
+	return "tiperf-run:" + t.UTC().Format("20060102T150405Z")
+}
+
+func Marshal(annotations []Annotation) ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	err := encoder.Encode(annotations)
+	return bytes.TrimSpace(buf.Bytes()), err
+}
+
+// A client of the grafana annotations api, the token is an api key or a service account token
+type Client struct {
+	URL    string
+	Token  string
+	client *http.Client
+}
+
+func NewClient(url string, token string) *Client {
+	return &Client{strings.TrimRight(url, "/"), token, &http.Client{Timeout: 10 * time.Second}}
+}
+
+// The api accepts one annotation per request
+func (c *Client) Post(annotation Annotation) error {
+	data, err := json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.URL+"/api/annotations", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if len(c.Token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("posting annotation to %s: %s, %s", c.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package grafana
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClientPost(t *testing.T) {
+	annotation := Annotation{
+		DashboardUID: "dash",
+		PanelID:      2,
+		Time:         1587340800000,
+		TimeEnd:      1587344400000,
+		Tags:         []string{"tiperf", "period"},
+		Text:         "workload: heavy write",
+	}
+
+	var got Annotation
+	var path, auth, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"id": 1, "message": "Annotation added"}`))
+	}))
+	defer server.Close()
+
+	err := NewClient(server.URL+"/", "secret").Post(annotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/annotations" {
+		t.Errorf("unexpected path: %s", path)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("unexpected authorization header: %s", auth)
+	}
+	if contentType != "application/json" {
+		t.Errorf("unexpected content type: %s", contentType)
+	}
+	if !reflect.DeepEqual(got, annotation) {
+		t.Errorf("unexpected body: %+v", got)
+	}
+}
+
+func TestClientPostFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Authorization")) != 0 {
+			t.Errorf("unexpected authorization header without token")
+		}
+		http.Error(w, `{"message": "Unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	err := NewClient(server.URL, "").Post(Annotation{Time: 1587340800000})
+	if err == nil {
+		t.Fatal("expected error on non-2xx response")
+	}
+	if !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("the status and the body should be in the error: %v", err)
+	}
+}
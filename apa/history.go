@@ -0,0 +1,254 @@
+package apa
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/detectors"
+	"github.com/innerr/tiperf/apa/history"
+	"github.com/innerr/tiperf/apa/tuning"
+)
+
+// The cluster name is the key of the history records
+func (a *AutoPerfAssistant) SetCluster(name string) {
+	a.cluster = name
+}
+
+// The results are saved into the history store, the stored periods are not analyzed again.
+// The periods are split again in each run, only the ones with exactly the same range are reused.
+func (a *AutoPerfAssistant) OpenHistory(path string) (err error) {
+	a.history, err = history.Open(path)
+	return
+}
+
+// The history is optional in analyzing: if it can't be opened, eg: locked by another run,
+// the analyzing goes on without it and the error is reported with the result
+func (a *AutoPerfAssistant) TryOpenHistory(path string) {
+	err := a.OpenHistory(path)
+	if err != nil {
+		a.con.Debug("## opening history failed, analyzing without it: ", err, "\n")
+		a.history = nil
+		a.historyErr = base.StepError{Step: "open history " + path, Err: err}
+	}
+}
+
+func (a *AutoPerfAssistant) CloseHistory() error {
+	if a.history == nil {
+		return nil
+	}
+	return a.history.Close()
+}
+
+// Fill the result by the stored period, return false if not found
+func (a *AutoPerfAssistant) loadHistoryPeriod(detector *detectors.Detectors, result *PeriodResult) (ok bool, err error) {
+	if a.history == nil {
+		return
+	}
+	config, err := a.configHash(detector)
+	if err != nil {
+		return
+	}
+	record, ok, err := a.history.FindPeriod(a.cluster, config, detector.GetWorkload(), result.Start, result.End)
+	if err != nil || !ok {
+		return
+	}
+	a.con.Debug("## ", result.Start.Format(base.TimeFormat), " => ", result.End.Format(base.TimeFormat), " found in history\n")
+	for _, event := range record.Events {
+		result.Events = append(result.Events, EventResult{event.When, event.Detector, event.Desc})
+	}
+	result.Correlations = record.Correlations
+	result.Advices = record.Advices
+	result.Stats = record.Stats
+	result.CachedAt = &record.Analyzed
+	return
+}
+
+// The settings changing the results: the custom detectors, the slos, the rules and the period splitting
+func (a *AutoPerfAssistant) configHash(detector *detectors.Detectors) (string, error) {
+	data, err := json.Marshal(struct {
+		Detectors   []string
+		Rules       tuning.Rules
+		Thresholds  []float64
+		MinPeriod   time.Duration
+		Seasonality string
+	}{detector.Settings(), a.rules, a.thresholds, a.minPeriod, a.seasonality.Name})
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Collect the key numbers of a period for the trends in history
+func (a *AutoPerfAssistant) collectStats(period base.Period) (stats map[string]float64, err error) {
+	stats = make(map[string]float64)
+	if desc, ok := a.periodWorkload(period); ok {
+		read, write := desc.Qps()
+		stats["qps"] = read + write
+		stats["read-qps"] = read
+		stats["write-qps"] = write
+	}
+	vectors, err := base.CollectSources(a.data, base.GetHistoryLatencySource(), period.Start, period.End, 0)
+	if err != nil {
+		return
+	}
+	for _, vector := range vectors {
+		_, avg, ok := base.StatsInRange(vector, period.Start, period.End)
+		if !ok {
+			continue
+		}
+		kind := string(vector.Metric["kind"])
+		if len(kind) == 0 {
+			continue
+		}
+		name := "p99"
+		if kind != "all" {
+			name = kind + "-p99"
+		}
+		stats[name] = avg
+	}
+	return
+}
+
+func (a *AutoPerfAssistant) saveHistory(detector *detectors.Detectors, report Report) error {
+	if a.history == nil {
+		return nil
+	}
+	config, err := a.configHash(detector)
+	if err != nil {
+		return err
+	}
+	run := history.Run{
+		Cluster:   a.cluster,
+		Time:      time.Now(),
+		From:      report.From,
+		To:        report.To,
+		Detectors: detector.GetWorkload(),
+		Config:    config,
+	}
+	var collect func(results []PeriodResult)
+	collect = func(results []PeriodResult) {
+		for _, result := range results {
+			if result.Transition {
+				continue
+			}
+			if len(result.Children) != 0 {
+				collect(result.Children)
+				continue
+			}
+			analyzed := run.Time
+			if result.CachedAt != nil {
+				analyzed = *result.CachedAt
+			}
+			record := history.PeriodRecord{
+				Start:        result.Start,
+				End:          result.End,
+				Workload:     result.Workload,
+				Stats:        result.Stats,
+				Correlations: result.Correlations,
+				Advices:      result.Advices,
+				Analyzed:     analyzed,
+			}
+			if result.Fingerprint != nil {
+				record.Fingerprint = result.Fingerprint.Name
+			}
+			for _, event := range result.Events {
+				record.Events = append(record.Events, history.EventRecord{
+					When:     event.When,
+					Detector: event.Detector,
+					Desc:     event.Desc,
+				})
+			}
+			run.Periods = append(run.Periods, record)
+		}
+	}
+	collect(report.Periods)
+	err = a.history.AddRun(&run)
+	if err != nil {
+		return err
+	}
+	a.con.Debug("## saved into history as run #", run.ID, "\n")
+	return nil
+}
+
+// List the runs in the analyze range, or all if the range is not specified
+func (a *AutoPerfAssistant) ListHistory() error {
+	runs, err := a.history.Runs("", a.timeRange.From, a.timeRange.To)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		a.con.Compact(run, "\n")
+	}
+	return nil
+}
+
+func (a *AutoPerfAssistant) ShowHistory(id uint64) error {
+	run, err := a.history.Run(id)
+	if err != nil {
+		return err
+	}
+	a.con.Compact(run, "\n")
+	for _, period := range run.Periods {
+		a.con.Compact("[", period.Start.In(base.Location).Format(base.TimeFormat), " => ",
+			period.End.In(base.Location).Format(base.TimeFormat), "]\n")
+		a.con.Compact("    ** ", period.Workload, "\n")
+		if len(period.Fingerprint) != 0 {
+			a.con.Compact("    ** ≈ ", period.Fingerprint, "\n")
+		}
+		var stats []string
+		for _, name := range history.StatNames {
+			if value, ok := period.Stats[name]; ok {
+				stats = append(stats, name+" "+history.FormatStat(name, value))
+			}
+		}
+		if len(stats) != 0 {
+			a.con.Compact("    ** ", strings.Join(stats, ", "), "\n")
+		}
+		for _, event := range period.Events {
+			a.outputLines(event.Desc, "    ")
+		}
+		for _, text := range append(period.Correlations, period.Advices...) {
+			a.outputLines(text, "    ")
+		}
+	}
+	return nil
+}
+
+// Show the stat of the periods of the cluster in the analyze range, or all if the range is not specified
+func (a *AutoPerfAssistant) ShowTrend(stat string, workload string) error {
+	known := false
+	for _, name := range history.StatNames {
+		known = known || name == stat
+	}
+	if !known {
+		return fmt.Errorf("unknown stat: '" + stat + "', should be: " + strings.Join(history.StatNames, ", "))
+	}
+	points, err := a.history.Trend(a.cluster, stat, workload, a.timeRange.From, a.timeRange.To)
+	if err != nil {
+		return err
+	}
+	for _, point := range points {
+		period := point.Period
+		name := period.Workload
+		if len(period.Fingerprint) != 0 {
+			name = period.Fingerprint
+		}
+		a.con.Compact("[", period.Start.In(base.Location).Format(base.TimeFormat), " => ",
+			period.End.In(base.Location).Format(base.TimeFormat), "] ", stat, " ",
+			history.FormatStat(stat, point.Value), ", ", name, "\n")
+	}
+	return nil
+}
+
+// Print a captured multi-line text with indent
+func (a *AutoPerfAssistant) outputLines(text string, indent string) {
+	for _, line := range strings.Split(text, "\n") {
+		a.con.Compact(indent, line, "\n")
+	}
+}
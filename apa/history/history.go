@@ -0,0 +1,239 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+var (
+	runsBucket    = []byte("runs")
+	periodsBucket = []byte("periods")
+)
+
+// A run is an analysis of a cluster in a time range, only the leaf periods are recorded
+type Run struct {
+	ID        uint64
+	Cluster   string
+	Time      time.Time
+	From      time.Time
+	To        time.Time
+	Detectors []string
+	// The hash of the settings changing the results, the periods are only reused with the same settings
+	Config  string `json:",omitempty"`
+	Periods []PeriodRecord
+}
+
+func (r Run) String() string {
+	return fmt.Sprintf("#%d %s %s => %s, analyzed at %s, %d period(s), detectors: %s", r.ID, r.Cluster,
+		r.From.In(base.Location).Format(base.TimeFormat), r.To.In(base.Location).Format(base.TimeFormat),
+		r.Time.In(base.Location).Format(base.TimeFormat), len(r.Periods), strings.Join(r.Detectors, ","))
+}
+
+// The stats are the key numbers of the period, see StatNames
+type PeriodRecord struct {
+	Start        time.Time
+	End          time.Time
+	Workload     string
+	Fingerprint  string             `json:",omitempty"`
+	Stats        map[string]float64 `json:",omitempty"`
+	Events       []EventRecord      `json:",omitempty"`
+	Correlations []string           `json:",omitempty"`
+	Advices      []string           `json:",omitempty"`
+	Analyzed     time.Time
+}
+
+type EventRecord struct {
+	When     time.Time
+	Detector string
+	Desc     string
+}
+
+// The stats recorded in each period
+var StatNames = []string{"qps", "read-qps", "write-qps", "p99", "read-p99", "write-p99"}
+
+func FormatStat(name string, value float64) string {
+	if strings.HasSuffix(name, "p99") {
+		return time.Duration(value * float64(time.Second)).Truncate(time.Microsecond).String()
+	}
+	return fmt.Sprintf("%.1f", value)
+}
+
+// An embedded store in a local file
+type Store struct {
+	db *bolt.DB
+}
+
+func Open(path string) (store *Store, err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		err = fmt.Errorf("opening history store %s: %v", path, err)
+		return
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{runsBucket, periodsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return
+	}
+	return &Store{db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// The ID of the run is assigned by the store.
+// The periods are also indexed by cluster, config, detectors and range, a later run overrides the same periods.
+func (s *Store) AddRun(run *Run) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		id, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		err = runs.Put(idKey(id), data)
+		if err != nil {
+			return err
+		}
+		periods := tx.Bucket(periodsBucket)
+		for _, period := range run.Periods {
+			data, err := json.Marshal(period)
+			if err != nil {
+				return err
+			}
+			err = periods.Put(periodKey(run.Cluster, run.Config, run.Detectors, period.Start, period.End), data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// The runs overlapped with the range, all if the range is zero, empty cluster means all clusters
+func (s *Store) Runs(cluster string, from time.Time, to time.Time) (runs []Run, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).ForEach(func(_, data []byte) error {
+			var run Run
+			if err := json.Unmarshal(data, &run); err != nil {
+				return err
+			}
+			if len(cluster) != 0 && run.Cluster != cluster {
+				return nil
+			}
+			if !from.IsZero() && (run.To.Before(from) || run.From.After(to)) {
+				return nil
+			}
+			runs = append(runs, run)
+			return nil
+		})
+	})
+	return
+}
+
+func (s *Store) Run(id uint64) (run Run, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(runsBucket).Get(idKey(id))
+		if data == nil {
+			return fmt.Errorf("run not found: #%d", id)
+		}
+		return json.Unmarshal(data, &run)
+	})
+	return
+}
+
+// Find the period analyzed with the same cluster, config, detectors and exactly the same range
+func (s *Store) FindPeriod(cluster string, config string, detectors []string, start time.Time,
+	end time.Time) (period PeriodRecord, ok bool, err error) {
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(periodsBucket).Get(periodKey(cluster, config, detectors, start, end))
+		if data == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(data, &period)
+	})
+	return
+}
+
+type TrendPoint struct {
+	Period PeriodRecord
+	Value  float64
+}
+
+// The stat of the periods in the range, the workload matches the fingerprint name or a part of the workload desc.
+// The periods analyzed with different detectors are deduplicated by range.
+func (s *Store) Trend(cluster string, stat string, workload string, from time.Time, to time.Time) (points []TrendPoint, err error) {
+	prefix := []byte(cluster + "\x00")
+	seen := make(map[string]bool)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(periodsBucket).Cursor()
+		for key, data := cursor.Seek(prefix); key != nil && strings.HasPrefix(string(key), string(prefix)); key, data = cursor.Next() {
+			var period PeriodRecord
+			if err := json.Unmarshal(data, &period); err != nil {
+				return err
+			}
+			if !from.IsZero() && (period.End.Before(from) || period.Start.After(to)) {
+				continue
+			}
+			if len(workload) != 0 && period.Fingerprint != workload && !strings.Contains(period.Workload, workload) {
+				continue
+			}
+			value, ok := period.Stats[stat]
+			if !ok {
+				continue
+			}
+			rangeKey := period.Start.String() + period.End.String()
+			if seen[rangeKey] {
+				continue
+			}
+			seen[rangeKey] = true
+			points = append(points, TrendPoint{period, value})
+		}
+		return nil
+	})
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Period.Start.Before(points[j].Period.Start)
+	})
+	return
+}
+
+func idKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// The cluster is the prefix, for scanning the periods of a cluster
+func periodKey(cluster string, config string, detectors []string, start time.Time, end time.Time) []byte {
+	sorted := append([]string{}, detectors...)
+	sort.Strings(sorted)
+	return []byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d\x00%d", cluster, config, strings.Join(sorted, ","),
+		start.UnixNano(), end.UnixNano()))
+}
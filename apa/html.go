@@ -0,0 +1,240 @@
+package apa
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/chart"
+	"github.com/innerr/tiperf/apa/detectors"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	reportMaxPoints = 480
+	reportMinStep   = 15 * time.Second
+
+	boundaryColor = "#888"
+	eventColor    = "#d62728"
+)
+
+// Analyze then write a self-contained html file, for postmortems
+func (a *AutoPerfAssistant) DoReport(detector detectors.Detectors, path string) error {
+	report, err := a.Analyze(&detector)
+	if err != nil {
+		return err
+	}
+	if len(report.Periods) == 0 {
+		return fmt.Errorf("no period detected")
+	}
+	page := a.newHTMLPage(report)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = htmlTemplate.Execute(file, page)
+	if err != nil {
+		return err
+	}
+	a.con.Compact("report written to ", path, "\n")
+	return nil
+}
+
+type htmlPage struct {
+	Cluster   string
+	From      string
+	To        string
+	Generated string
+	Failed    []string
+	Charts    []template.HTML
+	Periods   []htmlPeriod
+}
+
+type htmlPeriod struct {
+	Depth  int
+	Range  string
+	Lasted time.Duration
+	Result PeriodResult
+}
+
+// The failed charts are listed in the page, not failing the whole report
+func (a *AutoPerfAssistant) newHTMLPage(report Report) (page htmlPage) {
+	page = htmlPage{
+		Cluster:   a.cluster,
+		From:      report.From.Format(base.TimeFormat),
+		To:        report.To.Format(base.TimeFormat),
+		Generated: base.Now().Format(base.TimeFormat),
+		Failed:    append([]string{}, report.Failed...),
+	}
+
+	leaves := leafResults(report.Periods)
+	var spans []chart.Span
+	var markers []chart.Marker
+	var bars []chart.Bar
+	for i, result := range leaves {
+		label := result.Workload
+		if result.Transition {
+			label = "transition"
+		} else if result.Fingerprint != nil {
+			label = result.Fingerprint.Name
+		}
+		spans = append(spans, chart.Span{Start: result.Start, End: result.End, Label: label})
+		if i != 0 {
+			markers = append(markers, chart.Marker{At: result.Start, Label: result.StartReason, Color: boundaryColor})
+		}
+		if result.desc != nil {
+			bars = append(bars, chart.Bar{Label: result.Start.Format("01-02 15:04"), Values: result.desc.Vec()})
+		}
+	}
+	var events []chart.Marker
+	for _, result := range leaves {
+		for _, event := range result.Events {
+			events = append(events, chart.Marker{At: event.When, Label: "[" + event.Detector + "] " + event.Desc, Color: eventColor})
+		}
+	}
+	overlay := append(append([]chart.Marker{}, markers...), events...)
+
+	page.Charts = append(page.Charts, template.HTML(chart.Timeline(spans, report.From, report.To, events)))
+	page.Charts = append(page.Charts, template.HTML(chart.StackedBars("Workload mix per period (avg qps)",
+		base.WorkloadDescNames, bars, formatQps)))
+
+	duration := report.To.Sub(report.From)
+	step := (duration / reportMaxPoints).Truncate(time.Second)
+	if step < reportMinStep {
+		step = reportMinStep
+	}
+	for _, it := range []struct {
+		title   string
+		sources []base.SourceTask
+		label   string
+		format  func(float64) string
+	}{
+		{"QPS by type", base.GetPeriodWorkloadBreakingPointSource(), "type", formatQps},
+		{fmt.Sprintf("Query latency p%v", base.CapacityLatencyQuantile*100), base.GetCapacityLatencySource(), "", formatSeconds},
+		{"Up", base.GetPeriodAliveSource(), "instance", formatQps},
+	} {
+		vectors, err := base.CollectSources(a.data, it.sources, report.From, report.To, step)
+		if err != nil {
+			page.Failed = append(page.Failed, base.StepError{Step: "collect " + it.title, Err: err}.Error())
+			continue
+		}
+		var series []chart.Series
+		for _, vector := range vectors {
+			name := string(vector.Metric[model.LabelName(it.label)])
+			if len(it.label) == 0 || len(name) == 0 {
+				name = it.title
+			}
+			s := chart.Series{Name: name}
+			for _, pair := range vector.Pairs {
+				s.Times = append(s.Times, base.Ms2Time(pair.Timestamp))
+				s.Values = append(s.Values, float64(pair.Value))
+			}
+			series = append(series, s)
+		}
+		page.Charts = append(page.Charts, template.HTML(chart.LineChart(it.title, series, report.From, report.To, overlay, it.format)))
+	}
+
+	var add func(results []PeriodResult, depth int)
+	add = func(results []PeriodResult, depth int) {
+		for _, result := range results {
+			page.Periods = append(page.Periods, htmlPeriod{
+				depth,
+				result.Start.Format(base.TimeFormat) + " => " + result.End.Format(base.TimeFormat),
+				result.End.Sub(result.Start).Truncate(time.Second),
+				result,
+			})
+			add(result.Children, depth+1)
+		}
+	}
+	add(report.Periods, 0)
+	return
+}
+
+func leafResults(results []PeriodResult) (leaves []PeriodResult) {
+	for _, result := range results {
+		if len(result.Children) == 0 {
+			leaves = append(leaves, result)
+		} else {
+			leaves = append(leaves, leafResults(result.Children)...)
+		}
+	}
+	return
+}
+
+func formatQps(v float64) string {
+	if math.Abs(v) >= 1000 {
+		return fmt.Sprintf("%.1fk", v/1000)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", v), ".0")
+}
+
+func formatSeconds(v float64) string {
+	d := time.Duration(v * float64(time.Second))
+	switch {
+	case d >= time.Second:
+		d = d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		d = d.Round(10 * time.Microsecond)
+	default:
+		d = d.Round(time.Microsecond)
+	}
+	return d.String()
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"indent": func(depth int) string {
+		return fmt.Sprintf("%dem", depth*2)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>tiperf report {{.Cluster}} {{.From}} => {{.To}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+.meta { color: #666; }
+.failed { color: #d62728; }
+.chart { margin: 1em 0; }
+.period { border-left: 3px solid #4e79a7; margin: 0.8em 0; padding: 0.2em 0.8em; }
+.period.transition { border-color: #bab0ac; color: #888; }
+.period h3 { font-size: 1em; margin: 0.2em 0; }
+.period ul { margin: 0.2em 0; padding-left: 1.2em; }
+.events li { font-family: monospace; white-space: pre-wrap; }
+.label { color: #666; }
+</style>
+</head>
+<body>
+<h1>tiperf report: {{.Cluster}}</h1>
+<p class="meta">{{.From}} => {{.To}}, generated at {{.Generated}}</p>
+{{range .Failed}}<p class="failed">failed: {{.}}</p>
+{{end}}
+{{range .Charts}}<div class="chart">{{.}}</div>
+{{end}}
+<h2>Periods</h2>
+{{range .Periods}}{{$r := .Result}}
+<div class="period{{if $r.Transition}} transition{{end}}" style="margin-left: {{indent .Depth}}">
+<h3>{{.Range}}{{if $r.Transition}} transition{{end}}, lasted {{.Lasted}}</h3>
+<ul>
+{{if not $r.Transition}}<li><span class="label">workload:</span> {{$r.Workload}}</li>
+<li><span class="label">started by:</span> {{$r.StartReason}}</li>
+<li><span class="label">ended by:</span> {{$r.EndReason}}</li>
+{{end}}{{with $r.Fingerprint}}<li><span class="label">fingerprint:</span> {{.}}</li>{{end}}
+{{with $r.Seasonal}}<li><span class="label">seasonal:</span> {{.}}</li>{{end}}
+{{range $r.Gaps}}<li><span class="label">scrape gap:</span> {{.}}</li>{{end}}
+{{range $r.Annotations}}<li><span class="label">note:</span> {{.}}</li>{{end}}
+{{range $r.Failed}}<li class="failed">failed: {{.}}</li>{{end}}
+</ul>
+{{if $r.Events}}<ul class="events">{{range $r.Events}}<li>{{.Desc}}</li>{{end}}</ul>{{end}}
+{{if or $r.Correlations $r.Advices}}<ul class="events">{{range $r.Correlations}}<li>{{.}}</li>{{end}}{{range $r.Advices}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
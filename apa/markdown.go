@@ -0,0 +1,178 @@
+package apa
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+const markdownMaxFindings = 10
+
+// Render the report for pasting into tickets and chats
+func (a *AutoPerfAssistant) outputMarkdown(report Report) {
+	writeMarkdown(os.Stdout, a.cluster, report)
+}
+
+func writeMarkdown(w io.Writer, cluster string, report Report) {
+	fmt.Fprintf(w, "# tiperf: %s\n\n", cluster)
+	fmt.Fprintf(w, "%s => %s\n\n", report.From.Format(base.TimeFormat), report.To.Format(base.TimeFormat))
+
+	leaves := leafResults(report.Periods)
+	fmt.Fprintf(w, "## Summary\n\n")
+	for _, finding := range markdownFindings(leaves) {
+		fmt.Fprintf(w, "- %s\n", finding)
+	}
+	for _, failed := range report.Failed {
+		fmt.Fprintf(w, "- failed: %s\n", markdownEscape(failed))
+	}
+	fmt.Fprintln(w)
+
+	for _, result := range report.Periods {
+		writeMarkdownPeriod(w, result, 2)
+	}
+}
+
+// The most important findings first: the probable causes, then the advices, then the events count of each detector
+func markdownFindings(leaves []PeriodResult) (findings []string) {
+	periods := 0
+	counts := make(map[string]int)
+	var causes, advices []string
+	seenAdvices := make(map[string]bool)
+	for _, result := range leaves {
+		if !result.Transition {
+			periods += 1
+		}
+		at := result.Start.Format(base.TimeFormat)
+		if len(result.Correlations) != 0 {
+			causes = append(causes, fmt.Sprintf("%s (period %s)", firstLine(result.Correlations[0]), at))
+		}
+		for _, advice := range result.Advices {
+			line := firstLine(advice)
+			if !seenAdvices[line] {
+				seenAdvices[line] = true
+				advices = append(advices, line)
+			}
+		}
+		for _, event := range result.Events {
+			counts[event.Detector] += 1
+		}
+	}
+
+	findings = append(findings, fmt.Sprintf("%d period(s)", periods))
+	for _, it := range append(causes, advices...) {
+		if len(findings) >= markdownMaxFindings {
+			break
+		}
+		findings = append(findings, markdownEscape(strings.TrimPrefix(it, "** ")))
+	}
+	if len(counts) == 0 {
+		findings = append(findings, "no events")
+		return
+	}
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var events []string
+	for _, name := range names {
+		events = append(events, fmt.Sprintf("%s %d", name, counts[name]))
+	}
+	findings = append(findings, "events: "+strings.Join(events, ", "))
+	return
+}
+
+func writeMarkdownPeriod(w io.Writer, result PeriodResult, level int) {
+	if level > 6 {
+		level = 6
+	}
+	title := result.Start.Format(base.TimeFormat) + " => " + result.End.Format(base.TimeFormat)
+	lasted := result.End.Sub(result.Start).Truncate(time.Second)
+	if result.Transition {
+		fmt.Fprintf(w, "%s %s transition\n\n", strings.Repeat("#", level), title)
+		fmt.Fprintf(w, "- lasted: %s\n", lasted)
+	} else {
+		fmt.Fprintf(w, "%s %s %s\n\n", strings.Repeat("#", level), title, markdownEscape(result.Workload))
+		fmt.Fprintf(w, "- lasted: %s\n", lasted)
+		fmt.Fprintf(w, "- started by: %s\n", markdownEscape(result.StartReason))
+		fmt.Fprintf(w, "- ended by: %s\n", markdownEscape(result.EndReason))
+	}
+	if result.Fingerprint != nil {
+		fmt.Fprintf(w, "- fingerprint: %s\n", markdownEscape(result.Fingerprint.String()))
+	}
+	if len(result.Seasonal) != 0 {
+		fmt.Fprintf(w, "- seasonal: %s\n", markdownEscape(result.Seasonal))
+	}
+	for _, gap := range result.Gaps {
+		fmt.Fprintf(w, "- scrape gap: %s\n", gap)
+	}
+	for _, annotation := range result.Annotations {
+		fmt.Fprintf(w, "- note: %s\n", markdownEscape(annotation.String()))
+	}
+	for _, failed := range result.Failed {
+		fmt.Fprintf(w, "- failed: %s\n", markdownEscape(failed))
+	}
+	fmt.Fprintln(w)
+
+	if result.desc != nil {
+		fmt.Fprintf(w, "| type | avg qps |\n|---|---:|\n")
+		for i, qps := range result.desc.Vec() {
+			fmt.Fprintf(w, "| %s | %s |\n", base.WorkloadDescNames[i], formatQps(qps))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(result.Events) != 0 {
+		fmt.Fprintf(w, "Events:\n\n")
+		for _, event := range result.Events {
+			fmt.Fprintf(w, "- `%s` %s\n", event.Detector, markdownEscape(markdownEventDesc(event)))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(result.Correlations) != 0 || len(result.Advices) != 0 {
+		fmt.Fprintf(w, "Findings:\n\n")
+		for i, correlation := range result.Correlations {
+			if i >= base.CorrelationMaxShown {
+				break
+			}
+			fmt.Fprintf(w, "- %s\n", markdownEscape(strings.TrimPrefix(firstLine(correlation), "** ")))
+		}
+		for _, advice := range result.Advices {
+			lines := strings.Split(advice, "\n")
+			fmt.Fprintf(w, "- %s\n", markdownEscape(strings.TrimPrefix(lines[0], "** ")))
+			for _, line := range lines[1:] {
+				fmt.Fprintf(w, "  - %s\n", markdownEscape(strings.TrimSpace(line)))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, child := range result.Children {
+		writeMarkdownPeriod(w, child, level+1)
+	}
+}
+
+// The captured text has the time and the detail lines, keep them in one line
+func markdownEventDesc(event EventResult) string {
+	var lines []string
+	for _, line := range strings.Split(event.Desc, "\n") {
+		lines = append(lines, strings.TrimPrefix(strings.TrimSpace(line), "** "))
+	}
+	return strings.Join(lines, "; ")
+}
+
+func firstLine(text string) string {
+	return strings.SplitN(text, "\n", 2)[0]
+}
+
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`",
+	"#", "\\#", "[", "\\[", "]", "\\]", "<", "&lt;")
+
+func markdownEscape(text string) string {
+	return markdownEscaper.Replace(text)
+}
@@ -0,0 +1,389 @@
+package apa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/annotation"
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/detectors"
+	"github.com/innerr/tiperf/apa/fingerprint"
+	"github.com/innerr/tiperf/apa/tuning"
+)
+
+// The analysis result of the whole range, shared by the text and the structured outputs
+type Report struct {
+	From    time.Time
+	To      time.Time
+	Failed  []string `json:",omitempty"`
+	Periods []PeriodResult
+
+	failed error
+	// Also in 'failed', kept for the streaming output
+	historyFailed error
+}
+
+// The exported fields are for the structured outputs, the raw results are kept for the text output
+type PeriodResult struct {
+	Start        time.Time
+	End          time.Time
+	StartReason  string
+	EndReason    string
+	Transition   bool                    `json:",omitempty"`
+	Workload     string                  `json:",omitempty"`
+	Fingerprint  *fingerprint.Match      `json:",omitempty"`
+	Seasonal     string                  `json:",omitempty"`
+	Gaps         []base.Gap              `json:",omitempty"`
+	Annotations  []annotation.Annotation `json:",omitempty"`
+	Failed       []string                `json:",omitempty"`
+	Stats        map[string]float64      `json:",omitempty"`
+	CachedAt     *time.Time              `json:",omitempty"`
+	Events       []EventResult           `json:",omitempty"`
+	Correlations []string                `json:",omitempty"`
+	Advices      []string                `json:",omitempty"`
+	Children     []PeriodResult          `json:",omitempty"`
+
+	period       base.Period
+	desc         *base.WorkloadDesc
+	failed       error
+	events       detectors.Events
+	correlations detectors.Correlations
+	advices      []tuning.Advice
+}
+
+type EventResult struct {
+	When     time.Time
+	Detector string
+	Desc     string
+}
+
+// Detect the periods then run the detectors in each of them
+func (a *AutoPerfAssistant) Analyze(detector *detectors.Detectors) (report Report, err error) {
+	return a.analyze(detector, nil, nil)
+}
+
+// For streaming the output: 'begin' is called with the detected periods before analyzing,
+// 'each' is called after each top-level period is analyzed, both could be nil
+func (a *AutoPerfAssistant) analyze(
+	detector *detectors.Detectors,
+	begin func(report Report, periods []base.Period),
+	each func(result PeriodResult)) (report Report, err error) {
+
+	periods, err := a.DetectPeriods()
+	if err != nil && !base.IsPartial(err) {
+		return
+	}
+	report.failed = err
+	report.Failed = failedStrings(err)
+	err = nil
+	if len(periods) != 0 {
+		report.From = periods[0].Start
+		report.To = periods[len(periods)-1].End
+	}
+
+	for _, w := range detector.GetWorkload() {
+		a.con.Debug("## args: workload ", w, "\n")
+	}
+	if begin != nil {
+		begin(report, periods)
+	}
+
+	for _, period := range periods {
+		var result PeriodResult
+		result, err = a.analyzePeriod(detector, period)
+		if err != nil {
+			return
+		}
+		report.Periods = append(report.Periods, result)
+		if each != nil {
+			each(result)
+		}
+	}
+
+	report.historyFailed = a.historyErr
+	if historyErr := a.saveHistory(detector, report); historyErr != nil {
+		report.historyFailed = base.StepError{Step: "save history", Err: historyErr}
+	}
+	if report.historyFailed != nil {
+		partial := base.PartialError{}
+		partial.Add(report.failed)
+		partial.Add(report.historyFailed)
+		report.failed = partial.Err()
+		report.Failed = failedStrings(report.failed)
+	}
+	return
+}
+
+// The detectors run in the leaf periods and the transitions, the parents only have the workload and the nested children
+func (a *AutoPerfAssistant) analyzePeriod(detector *detectors.Detectors, period base.Period) (result PeriodResult, err error) {
+	result = PeriodResult{
+		Start:       period.Start,
+		End:         period.End,
+		StartReason: fmt.Sprint(period.StartReason),
+		EndReason:   fmt.Sprint(period.EndReason),
+		Transition:  period.Transition,
+		period:      period,
+	}
+
+	// The detectors still run in transitions, only the workload is not meaningful in them
+	var desc base.WorkloadDesc
+	var hasWorkload bool
+	if !period.Transition {
+		desc, hasWorkload = a.periodWorkload(period)
+		if hasWorkload {
+			result.Workload = desc.String()
+			result.desc = &desc
+			if match, ok := a.fingerprints.Match(desc); ok {
+				result.Fingerprint = &match
+			}
+		}
+		if period.Seasonal != nil {
+			result.Seasonal = period.Seasonal.String()
+		}
+	}
+
+	result.Annotations = a.annotations.Find(period.Start, period.End)
+
+	if len(period.Children) != 0 {
+		for _, child := range period.Children {
+			var childResult PeriodResult
+			childResult, err = a.analyzePeriod(detector, child)
+			if err != nil {
+				return
+			}
+			result.Children = append(result.Children, childResult)
+		}
+		return
+	}
+
+	result.Gaps = period.Gaps
+
+	// The transitions are not saved in history
+	if !period.Transition {
+		var cached bool
+		cached, err = a.loadHistoryPeriod(detector, &result)
+		if err != nil {
+			a.con.Debug("## loading from history failed: ", err, "\n")
+		}
+		err = nil
+		if cached && len(result.Stats) != 0 {
+			return
+		}
+		// The stats failed in the stored run are collected again
+		if cached {
+			var statsErr error
+			result.Stats, statsErr = a.collectStats(period)
+			if statsErr != nil {
+				var partial base.PartialError
+				partial.Add(base.StepError{Step: "collect stats for history", Err: statsErr})
+				result.failed = partial.Err()
+				result.Failed = failedStrings(result.failed)
+			}
+			return
+		}
+	}
+
+	var partial base.PartialError
+	found, err := detector.RunWorkloadByName(a.data, period, a.con)
+	if err != nil && !base.IsPartial(err) {
+		return
+	}
+	partial.Add(err)
+	err = nil
+
+	if a.history != nil && !period.Transition {
+		var statsErr error
+		result.Stats, statsErr = a.collectStats(period)
+		if statsErr != nil {
+			partial.Add(base.StepError{Step: "collect stats for history", Err: statsErr})
+		}
+	}
+	result.failed = partial.Err()
+	result.Failed = failedStrings(result.failed)
+
+	result.events = found.Events()
+	for name, events := range found {
+		for _, event := range events {
+			result.Events = append(result.Events, EventResult{event.When, name, capture(func(con base.Console) {
+				event.What.Output(event.When, con, "")
+			})})
+		}
+	}
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		return result.Events[i].When.Before(result.Events[j].When)
+	})
+
+	result.correlations = detectors.Correlate(result.events)
+	for _, correlation := range result.correlations {
+		result.Correlations = append(result.Correlations, capture(func(con base.Console) {
+			correlation.Output(con, "")
+		}))
+	}
+
+	result.advices = tuning.Advise(a.rules, found, desc, hasWorkload)
+	for _, advice := range result.advices {
+		result.Advices = append(result.Advices, capture(func(con base.Console) {
+			advice.Output(con, "")
+		}))
+	}
+	return
+}
+
+// Print each top-level period once it's analyzed
+func (a *AutoPerfAssistant) outputText(detector *detectors.Detectors) error {
+	var spark *sparkData
+	begin := func(report Report, periods []base.Period) {
+		a.checkPartial(report.failed, "")
+		if !a.con.DetailEnabled() || len(periods) == 0 {
+			return
+		}
+		data, err := a.collectSparkData(report.From, report.To)
+		if err != nil {
+			a.con.Debug("## collecting sparkline data failed: ", err, "\n")
+			return
+		}
+		spark = &data
+		a.outputRangeStrip(report.From, report.To, periods, data)
+	}
+	each := func(result PeriodResult) {
+		a.outputPeriodText(result, "", spark)
+	}
+	report, err := a.analyze(detector, begin, each)
+	if err != nil {
+		return err
+	}
+	if report.historyFailed != nil {
+		a.con.Compact("!! failed: ", report.historyFailed, "\n")
+	}
+	return nil
+}
+
+// The sparklines are shown if the data is not nil
+func (a *AutoPerfAssistant) outputPeriodText(result PeriodResult, indent string, spark *sparkData) {
+	period := result.period
+	if period.Transition {
+		a.con.Detail(indent, "[", period.Start.Format(base.TimeFormat), " => ", period.End.Format(base.TimeFormat), "]",
+			" transition, lasted ", period.End.Sub(period.Start).Truncate(time.Second), "\n")
+		a.outputAnnotationsText(result, indent+"    ")
+		a.outputFindingsText(result, indent+"    ")
+		return
+	}
+	a.con.Detail(indent, "[", period.Start.Format(base.TimeFormat), " => ", period.End.Format(base.TimeFormat), "]", "\n")
+	inner := indent + "    "
+	switch whyStartReason := period.StartReason.(type) {
+	case base.WorkloadBreakingReason:
+		a.con.Debug(inner, "## ", whyStartReason.Similarity, "\n")
+		a.con.Debug(inner, "## prev workload ", whyStartReason.PrevWorkload.RawString(), "\n")
+		a.con.Debug(inner, "## curr workload ", whyStartReason.CurrWorkload.RawString(), "\n")
+		a.con.Detail(inner, "** ", whyStartReason.CurrWorkload, "\n")
+	case base.ForcedBreakingReason:
+		a.con.Detail(inner, "** ", whyStartReason, "\n")
+	}
+
+	if result.Fingerprint != nil {
+		a.con.Detail(inner, "** ", *result.Fingerprint, "\n")
+	}
+	if period.Seasonal != nil {
+		a.con.Detail(inner, "** ", *period.Seasonal, "\n")
+	}
+	a.outputPeriodSpark(spark, period.Start, period.End, inner)
+	a.outputAnnotationsText(result, inner)
+
+	for _, child := range result.Children {
+		a.outputPeriodText(child, inner, spark)
+	}
+
+	a.outputFindingsText(result, inner)
+
+	lasted := period.End.Sub(period.Start).Truncate(time.Minute)
+	if whyEndReason, ok := period.EndReason.(base.WorkloadBreakingReason); ok {
+		a.con.Debug(inner, "## ", whyEndReason.Similarity, "\n")
+		a.con.Debug(inner, "## curr workload ", whyEndReason.PrevWorkload.RawString(), "\n")
+		a.con.Debug(inner, "## next workload ", whyEndReason.CurrWorkload.RawString(), "\n")
+	}
+	a.con.Detail(inner, "** lasted ", lasted, "\n")
+}
+
+func (a *AutoPerfAssistant) outputAnnotationsText(result PeriodResult, indent string) {
+	for _, annotation := range result.Annotations {
+		a.con.Detail(indent, "** note ", annotation, "\n")
+	}
+}
+
+func (a *AutoPerfAssistant) outputFindingsText(result PeriodResult, indent string) {
+	for _, gap := range result.Gaps {
+		a.con.Detail(indent, "** scrape gap ", gap, "\n")
+	}
+	a.checkPartial(result.failed, indent)
+	if result.CachedAt != nil {
+		a.outputCachedText(result, indent)
+	}
+	for _, event := range result.events {
+		event.What.Output(event.When, a.con, indent)
+	}
+	for i, correlation := range result.correlations {
+		if i >= base.CorrelationMaxShown {
+			a.con.Debug(indent, "## ", len(result.correlations)-i, " more correlation(s) hidden\n")
+			break
+		}
+		correlation.Output(a.con, indent)
+	}
+	for _, advice := range result.advices {
+		advice.Output(a.con, indent)
+	}
+}
+
+// The raw results are not stored in history, use the captured text
+func (a *AutoPerfAssistant) outputCachedText(result PeriodResult, indent string) {
+	a.con.Detail(indent, "** from history, analyzed at ", result.CachedAt.In(base.Location).Format(base.TimeFormat), "\n")
+	lines := []string{}
+	for _, event := range result.Events {
+		lines = append(lines, event.Desc)
+	}
+	for i, correlation := range result.Correlations {
+		if i >= base.CorrelationMaxShown {
+			break
+		}
+		lines = append(lines, correlation)
+	}
+	lines = append(lines, result.Advices...)
+	for _, text := range lines {
+		for _, line := range strings.Split(text, "\n") {
+			a.con.Detail(indent, line, "\n")
+		}
+	}
+}
+
+func (a *AutoPerfAssistant) outputJSON(report Report) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(report)
+}
+
+// Get the text of an output function
+func capture(output func(con base.Console)) string {
+	buf := bytes.Buffer{}
+	output(base.NewDetailConsole(&buf))
+	return strings.TrimSpace(buf.String())
+}
+
+func failedStrings(err error) (failed []string) {
+	if err == nil {
+		return
+	}
+	var partial *base.PartialError
+	if !errors.As(err, &partial) {
+		return []string{err.Error()}
+	}
+	for _, it := range partial.Errors {
+		failed = append(failed, it.Error())
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package apa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/detectors"
+	"github.com/innerr/tiperf/apa/fingerprint"
+	"github.com/prometheus/common/model"
+)
+
+func workloadVector(name string, start time.Time, values ...float64) base.CollectedSourceTasks {
+	vector := base.CollectedSourceTasks{Metric: model.Metric{"type": model.LabelValue(name)}}
+	for i, value := range values {
+		vector.Pairs = append(vector.Pairs, model.SamplePair{
+			Timestamp: base.Time2Ms(start.Add(time.Duration(i) * time.Minute)),
+			Value:     model.SampleValue(value),
+		})
+	}
+	return vector
+}
+
+// The whole range is one period, it has no workload breaking reasons
+func TestAnalyzeSinglePeriodWorkload(t *testing.T) {
+	start := time.Date(2020, 4, 20, 10, 0, 0, 0, time.UTC)
+	end := start.Add(5 * time.Minute)
+	a, err := NewAutoPerfAssistant("compact", base.TimeRange{From: start, To: end}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.workload = []base.CollectedSourceTasks{
+		workloadVector("kv_batch_get", start, 1000, 1100, 900, 1000, 1000),
+		workloadVector("kv_commit", start, 100, 90, 110, 100, 100),
+	}
+	desc, ok := base.WorkloadDescInRange(a.workload, start, end)
+	if !ok {
+		t.Fatal("expected the workload of the range")
+	}
+	known, err := fingerprint.NewFingerprint("tpcc", desc, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.fingerprints.Add(known)
+
+	period := base.Period{Start: start, End: end, StartReason: "start", EndReason: "end"}
+	result, err := a.analyzePeriod(&detectors.Detectors{}, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Workload != desc.String() {
+		t.Errorf("expected workload %s, got '%s'", desc, result.Workload)
+	}
+	if result.Fingerprint == nil || result.Fingerprint.Name != "tpcc" {
+		t.Errorf("expected matching tpcc, got %v", result.Fingerprint)
+	}
+}
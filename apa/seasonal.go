@@ -0,0 +1,31 @@
+package apa
+
+import (
+	"github.com/innerr/tiperf/apa/base"
+)
+
+// Should be called before detecting
+func (a *AutoPerfAssistant) SetSeasonality(name string) error {
+	seasonality, err := base.ParseSeasonality(name)
+	if err != nil {
+		return err
+	}
+	a.seasonality = seasonality
+	return nil
+}
+
+// Judge each period by the same time in history cycles, the seasonal changes are already not split in detecting
+func (a *AutoPerfAssistant) judgeSeasonality(origin []base.Period) (periods []base.Period, err error) {
+	var partial base.PartialError
+	for _, period := range origin {
+		judgement, judgeErr := base.JudgeSeasonality(a.data, a.seasonality, period.Start, period.End, a.con)
+		if judgeErr != nil {
+			partial.Add(base.StepError{Step: "judge seasonality of " + period.Start.Format(base.TimeFormat), Err: judgeErr})
+		} else {
+			period.Seasonal = &judgement
+		}
+		periods = append(periods, period)
+	}
+	err = partial.Err()
+	return
+}
@@ -0,0 +1,127 @@
+package apa
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/chart"
+)
+
+const (
+	sparkRangeWidth  = 60
+	sparkPeriodWidth = 40
+	sparkMaxPoints   = 600
+	sparkMinStep     = 15 * time.Second
+)
+
+// The total qps and the main latency quantile of the whole range, sliced by periods when output
+type sparkData struct {
+	qps     chart.Series
+	latency chart.Series
+}
+
+// The qps is summed from the workload vectors fetched in detecting periods, only the latency is queried
+func (a *AutoPerfAssistant) collectSparkData(from time.Time, to time.Time) (data sparkData, err error) {
+	if len(a.workload) != 0 {
+		for i, pair := range a.workload[0].Pairs {
+			t := base.Ms2Time(pair.Timestamp)
+			if t.Before(from) || t.After(to) {
+				continue
+			}
+			sum := 0.0
+			for _, vector := range a.workload {
+				sum += float64(vector.Pairs[i].Value)
+			}
+			data.qps.Times = append(data.qps.Times, t)
+			data.qps.Values = append(data.qps.Values, sum)
+		}
+	}
+
+	step := (to.Sub(from) / sparkMaxPoints).Truncate(time.Second)
+	if step < sparkMinStep {
+		step = sparkMinStep
+	}
+	vectors, err := base.CollectSources(a.data, base.GetCapacityLatencySource(), from, to, step)
+	if err != nil {
+		return
+	}
+	if len(vectors) != 0 {
+		for _, pair := range vectors[0].Pairs {
+			data.latency.Times = append(data.latency.Times, base.Ms2Time(pair.Timestamp))
+			data.latency.Values = append(data.latency.Values, float64(pair.Value))
+		}
+	}
+	return
+}
+
+// The top strip: the total qps of the whole range, and the period boundaries
+func (a *AutoPerfAssistant) outputRangeStrip(from time.Time, to time.Time, periods []base.Period, data sparkData) {
+	var boundaries []time.Time
+	for _, period := range leafPeriods(periods) {
+		boundaries = append(boundaries, period.Start)
+	}
+	a.con.Detail(fmt.Sprintf("%-8s", "qps"), chart.Sparkline(data.qps.Values, sparkRangeWidth), "\n")
+	a.con.Detail(fmt.Sprintf("%-8s", "periods"), chart.Strip(from, to, boundaries, sparkRangeWidth), "\n")
+}
+
+func leafPeriods(periods []base.Period) (leaves []base.Period) {
+	for _, period := range periods {
+		if len(period.Children) == 0 {
+			leaves = append(leaves, period)
+		} else {
+			leaves = append(leaves, leafPeriods(period.Children)...)
+		}
+	}
+	return
+}
+
+func (a *AutoPerfAssistant) outputPeriodSpark(data *sparkData, start time.Time, end time.Time, indent string) {
+	if data == nil {
+		return
+	}
+	for _, it := range []struct {
+		name   string
+		series chart.Series
+		format func(float64) string
+	}{
+		{"qps", data.qps, formatQps},
+		{fmt.Sprintf("p%v", base.CapacityLatencyQuantile*100), data.latency, formatSeconds},
+	} {
+		values := seriesIn(it.series, start, end)
+		avg, max, ok := avgMax(values)
+		if !ok {
+			continue
+		}
+		a.con.Detail(indent, "** ", fmt.Sprintf("%-4s", it.name), chart.Sparkline(values, sparkPeriodWidth),
+			" avg ", it.format(avg), ", max ", it.format(max), "\n")
+	}
+}
+
+func seriesIn(series chart.Series, start time.Time, end time.Time) (values []float64) {
+	for i, t := range series.Times {
+		if !t.Before(start) && !t.After(end) {
+			values = append(values, series.Values[i])
+		}
+	}
+	return
+}
+
+func avgMax(values []float64) (avg float64, max float64, ok bool) {
+	count := 0
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		if count == 0 || v > max {
+			max = v
+		}
+		avg += v
+		count += 1
+	}
+	if count == 0 {
+		return
+	}
+	return avg / float64(count), max, true
+}
@@ -0,0 +1,86 @@
+package tuning
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+	"github.com/innerr/tiperf/apa/detectors"
+)
+
+// The evidence events are the ones triggered the rule
+type Advice struct {
+	Rule     Rule
+	Evidence []Evidence
+}
+
+type Evidence struct {
+	Detector string
+	Event    detectors.Event
+}
+
+func (e Evidence) String() string {
+	desc := e.Detector
+	if correlatable, ok := e.Event.What.(detectors.Correlatable); ok {
+		desc = correlatable.Correlation().String()
+	}
+	return fmt.Sprintf("[%s] %s %s", e.Detector, e.Event.When.Format(base.TimeFormat), desc)
+}
+
+func (a Advice) Output(con base.Console, indent string) {
+	con.Detail(indent, "** advice: ", a.Rule.Advice, "\n")
+	if len(a.Rule.Knob) != 0 {
+		con.Detail(indent, "    knob: ", a.Rule.Knob, "\n")
+	}
+	var evidence []string
+	for _, it := range a.Evidence {
+		evidence = append(evidence, it.String())
+	}
+	con.Detail(indent, "    evidence: ", strings.Join(evidence, "; "), "\n")
+	con.Debug(indent, "    ## rule ", a.Rule.Name, "\n")
+}
+
+// Advise by the events of each detector and the workload of the period, hasWorkload is false if it's unknown
+func Advise(rules Rules, found detectors.FoundEvents, workload base.WorkloadDesc, hasWorkload bool) (advices []Advice) {
+	for _, rule := range rules {
+		if !rule.MatchWorkload(workload, hasWorkload) {
+			continue
+		}
+		var evidence []Evidence
+		for _, event := range found[rule.Detector] {
+			fields, err := eventFields(event)
+			if err != nil {
+				continue
+			}
+			matched := true
+			for _, condition := range rule.Conditions {
+				if !condition.Match(fields) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				evidence = append(evidence, Evidence{rule.Detector, event})
+			}
+		}
+		if len(evidence) != 0 {
+			advices = append(advices, Advice{rule, evidence})
+		}
+	}
+	return
+}
+
+func eventFields(event detectors.Event) (fields map[string]interface{}, err error) {
+	data, err := json.Marshal(event.What)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &fields)
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["When"] = event.When.Format(time.RFC3339)
+	return
+}
@@ -0,0 +1,99 @@
+package tuning
+
+// Same format as the rules file, see README
+const defaultRules = `[
+	{
+		"name": "raftstore-saturated-on-write",
+		"detector": "saturation",
+		"conditions": [{"field": "Pool", "op": "==", "value": "raftstore"}],
+		"workload": "write",
+		"knob": "raftstore.store-pool-size",
+		"advice": "raftstore saturated on write workload: raise raftstore.store-pool-size"
+	},
+	{
+		"name": "apply-saturated-on-write",
+		"detector": "saturation",
+		"conditions": [{"field": "Pool", "op": "==", "value": "apply"}],
+		"workload": "write",
+		"knob": "raftstore.apply-pool-size",
+		"advice": "apply pool saturated on write workload: raise raftstore.apply-pool-size"
+	},
+	{
+		"name": "scheduler-saturated",
+		"detector": "saturation",
+		"conditions": [{"field": "Pool", "op": "==", "value": "scheduler"}],
+		"knob": "storage.scheduler-worker-pool-size",
+		"advice": "scheduler workers saturated: raise storage.scheduler-worker-pool-size"
+	},
+	{
+		"name": "grpc-saturated",
+		"detector": "saturation",
+		"conditions": [{"field": "Pool", "op": "==", "value": "grpc"}],
+		"knob": "server.grpc-concurrency",
+		"advice": "grpc threads saturated: raise server.grpc-concurrency"
+	},
+	{
+		"name": "unified-read-pool-saturated-on-read",
+		"detector": "saturation",
+		"conditions": [{"field": "Pool", "op": "==", "value": "unified-read-pool"}],
+		"workload": "read",
+		"knob": "readpool.unified.max-thread-count",
+		"advice": "unified read pool saturated on read workload: raise readpool.unified.max-thread-count"
+	},
+	{
+		"name": "pessimistic-write-lock-wait",
+		"detector": "contention",
+		"conditions": [{"field": "Signals", "op": "contains", "value": "lock wait"}],
+		"workload": "pessimistic write",
+		"advice": "pessimistic write with high lock wait: review hot keys"
+	},
+	{
+		"name": "write-conflicts",
+		"detector": "contention",
+		"conditions": [{"field": "Signals", "op": "contains", "value": "write conflicts"}],
+		"advice": "frequent write conflicts: review hot keys, or try pessimistic transactions"
+	},
+	{
+		"name": "stall-by-level0-files",
+		"detector": "stall",
+		"conditions": [{"field": "Trigger", "op": "contains", "value": "level0"}],
+		"knob": "rocksdb.max-background-jobs",
+		"advice": "write stall by too many L0 files: raise rocksdb.max-background-jobs or rocksdb.defaultcf.level0-slowdown-writes-trigger"
+	},
+	{
+		"name": "stall-by-pending-compaction",
+		"detector": "stall",
+		"conditions": [{"field": "Trigger", "op": "contains", "value": "pending_compaction"}],
+		"knob": "rocksdb.rate-bytes-per-sec",
+		"advice": "write stall by pending compaction bytes: raise rocksdb.rate-bytes-per-sec or rocksdb.defaultcf.soft-pending-compaction-bytes-limit"
+	},
+	{
+		"name": "stall-by-memtables",
+		"detector": "stall",
+		"conditions": [{"field": "Trigger", "op": "contains", "value": "memtable"}],
+		"knob": "rocksdb.defaultcf.max-write-buffer-number",
+		"advice": "write stall by too many memtables: raise rocksdb.defaultcf.max-write-buffer-number"
+	},
+	{
+		"name": "hot-write-store-not-scheduled",
+		"detector": "hotspot",
+		"conditions": [{"field": "Kind", "op": "==", "value": "write"}, {"field": "Scheduled", "op": "==", "value": null}],
+		"knob": "hot-region-schedule-limit",
+		"advice": "persistent hot write store without pd hot scheduling: check pd hot-region-schedule-limit, or split the hot regions"
+	},
+	{
+		"name": "split-storm",
+		"detector": "scheduling",
+		"conditions": [{"field": "Category", "op": "==", "value": "split"}],
+		"knob": "coprocessor.region-split-size",
+		"advice": "region split storm: pre-split tables before bulk importing"
+	}
+]`
+
+func DefaultRules() Rules {
+	rules, err := ParseRules([]byte(defaultRules))
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
@@ -0,0 +1,151 @@
+package tuning
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/innerr/tiperf/apa/base"
+)
+
+// A rule fires when an event of the detector matches all the conditions,
+//   and the period's workload matches the 'workload' if it's not empty
+type Rule struct {
+	Name       string      `json:"name"`
+	Detector   string      `json:"detector"`
+	Conditions []Condition `json:"conditions"`
+	Workload   string      `json:"workload"`
+	Knob       string      `json:"knob"`
+	Advice     string      `json:"advice"`
+}
+
+// The workload is matched exactly with the class or the level of the period's workload, or both,
+// eg: 'read', 'read and write', 'pessimistic write', 'heavy', 'heavy write'. Empty matches all.
+func (r Rule) MatchWorkload(desc base.WorkloadDesc, ok bool) bool {
+	if len(r.Workload) == 0 {
+		return true
+	}
+	if !ok {
+		return false
+	}
+	return r.Workload == desc.Type() || r.Workload == desc.Level() || r.Workload == desc.String()
+}
+
+// The field is the name of the event info's field, the value could be a number, a string or a duration like '10m'.
+// Ops: ==, !=, >, >=, <, <=, contains
+type Condition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+type Rules []Rule
+
+func ParseRules(data []byte) (rules Rules, err error) {
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		err = fmt.Errorf("parsing tuning rules: %v", err)
+		return
+	}
+	for _, rule := range rules {
+		if len(rule.Name) == 0 || len(rule.Detector) == 0 || len(rule.Advice) == 0 {
+			err = fmt.Errorf("parsing tuning rules, 'name', 'detector' and 'advice' are required: %v", rule)
+			return
+		}
+		for _, condition := range rule.Conditions {
+			switch condition.Op {
+			case "==", "!=", ">", ">=", "<", "<=", "contains":
+			default:
+				err = fmt.Errorf("parsing tuning rule %s, unknown op: '%s'", rule.Name, condition.Op)
+				return
+			}
+		}
+	}
+	return
+}
+
+func LoadRules(path string) (rules Rules, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return ParseRules(data)
+}
+
+// The rules with the same names in 'other' override the origin ones
+func (r Rules) Merge(other Rules) (rules Rules) {
+	overrided := make(map[string]bool)
+	for _, rule := range other {
+		overrided[rule.Name] = true
+	}
+	for _, rule := range r {
+		if !overrided[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, other...)
+}
+
+// The fields are from the json encoded event info
+func (c Condition) Match(fields map[string]interface{}) bool {
+	field, ok := fields[c.Field]
+	if !ok {
+		return false
+	}
+
+	if c.Op == "contains" {
+		raw, err := json.Marshal(field)
+		if err != nil {
+			return false
+		}
+		return strings.Contains(strings.ToLower(string(raw)), strings.ToLower(fmt.Sprintf("%v", c.Value)))
+	}
+
+	actual, actualIsNum := toNumber(field)
+	expected, expectedIsNum := toNumber(c.Value)
+	if !actualIsNum || !expectedIsNum {
+		same := fmt.Sprintf("%v", field) == fmt.Sprintf("%v", c.Value)
+		switch c.Op {
+		case "==":
+			return same
+		case "!=":
+			return !same
+		}
+		return false
+	}
+
+	switch c.Op {
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	}
+	return false
+}
+
+// Durations are encoded as nanoseconds in json, so a duration string is converted to nanoseconds
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		if number, err := strconv.ParseFloat(v, 64); err == nil {
+			return number, true
+		}
+		if duration, err := time.ParseDuration(v); err == nil {
+			return float64(duration), true
+		}
+	}
+	return 0, false
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/innerr/tiperf/apa"
 	"github.com/innerr/tiperf/apa/base"
 	"github.com/innerr/tiperf/apa/detectors"
+	"github.com/innerr/tiperf/apa/history"
 
 	"github.com/spf13/cobra"
 )
@@ -22,6 +26,39 @@ var (
 	to       string
 	duration time.Duration
 	period   int
+
+	minPeriod time.Duration
+
+	periodThresholds []string
+	periodLevel      int
+
+	slos []string
+
+	latency time.Duration
+
+	rules string
+
+	detectorsFile string
+
+	seasonal string
+
+	fingerprints string
+
+	tz string
+
+	annotations string
+	at          string
+	boundary    bool
+
+	output string
+
+	historyPath string
+	cluster     string
+	workload    string
+
+	htmlPath string
+
+	grafanaExport apa.GrafanaExport
 )
 
 func main() {
@@ -37,12 +74,45 @@ func main() {
 
 	cmd.PersistentFlags().StringVar(&verb, "verb", "detail", "Ouput level, sould be: debug|detail|compact")
 
-	cmd.PersistentFlags().StringVarP(&from, "from", "f", "", "Analyze from this time, format: 2006-01-02 15:04:05")
-	cmd.PersistentFlags().StringVarP(&to, "to", "t", "", "Analyze to this time, format: 2006-01-02 15:04:05")
-	cmd.PersistentFlags().DurationVarP(&duration, "duration", "d", 0, "Analyze from `duration` ago to now, examples: 1h, 30m")
+	cmd.PersistentFlags().StringVarP(&from, "from", "f", "", "Analyze from this time, formats: '2006-01-02 15:04:05', RFC3339, epoch, "+
+		"'now-6h', 'yesterday 14:00', '2020-04-20 05:00 +2h'")
+	cmd.PersistentFlags().StringVarP(&to, "to", "t", "", "Analyze to this time, formats: same as 'from'")
+	cmd.PersistentFlags().StringVar(&tz, "tz", "Local", "Time zone of the time args and the output, examples: UTC, Asia/Shanghai, +08:00")
+	cmd.PersistentFlags().DurationVarP(&duration, "duration", "d", 0, "Analyze `duration` long, ends at now, or starts at 'from', or ends at 'to', examples: 1h, 30m")
 	cmd.PersistentFlags().IntVarP(&period, "period", "p", 0, "A period is a time span runs alike workload. Analyze the last N period")
 
+	cmd.PersistentFlags().StringSliceVar(&periodThresholds, "period-thresholds", nil,
+		"Workload similarity thresholds of splitting periods, each one is a level of nested periods, the lower the coarser, example: 0.3,0.6. "+
+			"Default is one level by the breaking function of the workload source")
+	cmd.PersistentFlags().IntVar(&periodLevel, "period-level", 0, "The level of nested periods that 'period' applies at, 0 is the coarsest")
+	cmd.PersistentFlags().DurationVar(&minPeriod, "min-period", base.MinPeriodDuration, "Periods shorter than this are merged into the alike neighbours "+
+		"or marked as transitions, 0 keeps all detected periods")
+
+	cmd.PersistentFlags().StringArrayVar(&slos, "slo", nil, "Latency SLO, could be multiply, format: component:type:quantile<threshold, "+
+		"examples: 'tidb:Select:p99<50ms', 'tikv:*:p999<100ms'")
+
+	cmd.PersistentFlags().StringVar(&rules, "rules", "", "Tuning rules file in json, extends or overrides the default rules")
+
+	cmd.PersistentFlags().StringVar(&detectorsFile, "detectors", "", "Detectors defined in json file, selectable by name in timeline")
+
+	cmd.PersistentFlags().StringVar(&seasonal, "seasonal", "", "Judge periods by the same time in history, should be: daily|weekly")
+
+	cmd.PersistentFlags().StringVar(&fingerprints, "fingerprints", defaultLocalPath("fingerprints.json"), "Workload fingerprints file")
+
+	cmd.PersistentFlags().StringVar(&annotations, "annotations", defaultLocalPath("annotations.json"), "Annotations file")
+
+	cmd.PersistentFlags().StringVar(&historyPath, "history", defaultLocalPath("history.db"), "History store file, empty means disabled")
+	cmd.PersistentFlags().StringVar(&cluster, "cluster", "", "Cluster name in history, default is the prometheus address")
+
+	cmd.PersistentFlags().StringVarP(&output, "output", "o", "text", "Output format, should be: text|json|markdown")
+
 	registerTimeline(cmd)
+	registerCapacity(cmd)
+	registerFingerprint(cmd)
+	registerAnnotate(cmd)
+	registerHistory(cmd)
+	registerReport(cmd)
+	registerExport(cmd)
 
 	// TODO: more commands
 
@@ -50,16 +120,79 @@ func main() {
 }
 
 func newAutoPerfAssistant() *apa.AutoPerfAssistant {
+	apa := newOfflineAutoPerfAssistant()
+	err := apa.AddPrometheus(host, port)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	return apa
+}
+
+// Without data sources, for the commands only handling local files
+func newOfflineAutoPerfAssistant() *apa.AutoPerfAssistant {
+	err := base.SetLocation(tz)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 	timeRange, err := base.NewTimeRangeFromArgs(from, to, duration)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-	apa := apa.NewAutoPerfAssistant(verb, timeRange, period)
-	err = apa.AddPrometheus(host, port)
+	apa, err := apa.NewAutoPerfAssistant(verb, timeRange, period)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
-		os.Exit(2)
+		os.Exit(1)
+	}
+	apa.SetMinPeriodDuration(minPeriod)
+	if len(cluster) != 0 {
+		apa.SetCluster(cluster)
+	} else {
+		apa.SetCluster(host + ":" + strconv.Itoa(port))
+	}
+	thresholds := make([]float64, len(periodThresholds))
+	for i, threshold := range periodThresholds {
+		thresholds[i], err = strconv.ParseFloat(threshold, 64)
+		if err != nil {
+			fmt.Printf("Error: bad period similarity threshold: '%s'\n", threshold)
+			os.Exit(1)
+		}
+	}
+	err = apa.SetPeriodLevels(thresholds, periodLevel)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = apa.LoadFingerprints(fingerprints)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = apa.LoadAnnotations(annotations)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = apa.SetOutput(output)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(seasonal) != 0 {
+		err = apa.SetSeasonality(seasonal)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(rules) != 0 {
+		err = apa.AddTuningRules(rules)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 	return apa
 }
@@ -72,13 +205,47 @@ func callHandleFunc(f func() error) {
 	}
 }
 
+func newDetectors() detectors.Detectors {
+	dectectors := detectors.NewDetectors()
+	if len(detectorsFile) != 0 {
+		callHandleFunc(func() error {
+			return dectectors.RegisterFromFile(detectorsFile)
+		})
+	}
+	return dectectors
+}
+
+// Select the detectors by args, then run the analyzing with the history store opened if it could be
+func runDetectors(dectectors *detectors.Detectors, args []string, run func(apa *apa.AutoPerfAssistant) error) {
+	apa := newAutoPerfAssistant()
+	if len(historyPath) != 0 {
+		apa.TryOpenHistory(historyPath)
+		defer apa.CloseHistory()
+	}
+	callHandleFunc(func() (err error) {
+		if len(slos) != 0 {
+			var parsed []base.LatencySLO
+			parsed, err = base.ParseLatencySLOs(slos)
+			if err != nil {
+				return
+			}
+			dectectors.SetLatencySLOs(parsed)
+		}
+		err = dectectors.ParseWorkloadFromArgs(args)
+		if err != nil {
+			return
+		}
+		return run(apa)
+	})
+}
+
 func registerTimeline(parent *cobra.Command) {
 	cmd := &cobra.Command{
 		Use:   "timeline",
 		Short: "Analyze cluster and report in timeline",
 		Args:  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			dectectors := detectors.NewDetectors()
+			dectectors := newDetectors()
 			if len(args) == 0 {
 				fmt.Println("Usage: append 'name' to select features, '~name' to filter features")
 				fmt.Println("Feature list:")
@@ -88,15 +255,240 @@ func registerTimeline(parent *cobra.Command) {
 				}
 				return
 			}
+			runDetectors(&dectectors, args, func(apa *apa.AutoPerfAssistant) error {
+				return apa.DoDectect(dectectors)
+			})
+		},
+	}
+	parent.AddCommand(cmd)
+}
+
+func registerCapacity(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "Estimate the saturation knee of each workload class by throughput and latency of periods",
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newAutoPerfAssistant()
+			callHandleFunc(func() error {
+				return apa.DoCapacity(latency)
+			})
+		},
+	}
+	cmd.Flags().DurationVar(&latency, "latency", 50*time.Millisecond, "The latency limit of the knee, examples: 50ms, 1s")
+	parent.AddCommand(cmd)
+}
+
+// The local files are in ~/.tiperf
+func defaultLocalPath(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, ".tiperf", name)
+}
+
+func registerFingerprint(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "fingerprint",
+		Short: "Manage named workload fingerprints, periods are matched with them in timeline",
+	}
+
+	add := &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add the workload in the time range (--from/--to/--duration) as a fingerprint",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
 			apa := newAutoPerfAssistant()
+			callHandleFunc(func() error {
+				return apa.AddFingerprint(args[0])
+			})
+		},
+	}
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List all fingerprints",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			newOfflineAutoPerfAssistant().ListFingerprints()
+		},
+	}
+	del := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a fingerprint",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newOfflineAutoPerfAssistant()
+			callHandleFunc(func() error {
+				return apa.DeleteFingerprint(args[0])
+			})
+		},
+	}
+
+	cmd.AddCommand(add, list, del)
+	parent.AddCommand(cmd)
+}
+
+func registerAnnotate(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "Manage notes of time ranges, they are shown in the matched periods in timeline",
+	}
+
+	add := &cobra.Command{
+		Use:   "add <note>",
+		Short: "Annotate a point in time (--at), or a time range (--from/--to/--duration)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newOfflineAutoPerfAssistant()
 			callHandleFunc(func() (err error) {
-				err = dectectors.ParseWorkloadFromArgs(args)
+				var when time.Time
+				if len(at) != 0 {
+					when, err = base.ParseTimeArg(at, base.Now())
+					if err != nil {
+						return
+					}
+				}
+				return apa.AddAnnotation(args[0], when, boundary)
+			})
+		},
+	}
+	add.Flags().StringVar(&at, "at", "", "The time of the note, formats: same as 'from'")
+	add.Flags().BoolVar(&boundary, "boundary", false, "Force a period boundary at the start time of the note")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the annotations in the time range, or all if not specified",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			newOfflineAutoPerfAssistant().ListAnnotations()
+		},
+	}
+	del := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete an annotation",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newOfflineAutoPerfAssistant()
+			callHandleFunc(func() error {
+				id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
 				if err != nil {
-					return
+					return fmt.Errorf("bad annotation id: '%s'", args[0])
 				}
-				return apa.DoDectect(dectectors)
+				return apa.DeleteAnnotation(id)
+			})
+		},
+	}
+
+	cmd.AddCommand(add, list, del)
+	parent.AddCommand(cmd)
+}
+
+func registerHistory(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Query the results of the previous timeline runs",
+	}
+
+	// The history store is required by all sub commands
+	newHistoryAssistant := func() *apa.AutoPerfAssistant {
+		if len(historyPath) == 0 {
+			fmt.Println("Error: history store is disabled")
+			os.Exit(1)
+		}
+		apa := newOfflineAutoPerfAssistant()
+		callHandleFunc(func() error {
+			return apa.OpenHistory(historyPath)
+		})
+		return apa
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the runs in the time range, or all if not specified",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newHistoryAssistant()
+			defer apa.CloseHistory()
+			callHandleFunc(apa.ListHistory)
+		},
+	}
+	show := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show the periods and events of a run",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newHistoryAssistant()
+			defer apa.CloseHistory()
+			callHandleFunc(func() error {
+				id, err := strconv.ParseUint(strings.TrimPrefix(args[0], "#"), 10, 64)
+				if err != nil {
+					return fmt.Errorf("bad run id: '%s'", args[0])
+				}
+				return apa.ShowHistory(id)
+			})
+		},
+	}
+	trend := &cobra.Command{
+		Use:   "trend <stat>",
+		Short: "Show a stat of the periods of the cluster across runs, stats: " + strings.Join(history.StatNames, ", "),
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apa := newHistoryAssistant()
+			defer apa.CloseHistory()
+			callHandleFunc(func() error {
+				return apa.ShowTrend(args[0], workload)
+			})
+		},
+	}
+	trend.Flags().StringVar(&workload, "workload", "", "Only the periods matched this fingerprint name or workload desc")
+
+	cmd.AddCommand(list, show, trend)
+	parent.AddCommand(cmd)
+}
+
+func registerReport(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Analyze like timeline, write the result as a self-contained html file with charts, default features: all",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(htmlPath) == 0 {
+				fmt.Println("Error: the output file should be specified by --html")
+				os.Exit(1)
+			}
+			if len(args) == 0 {
+				args = []string{"all"}
+			}
+			dectectors := newDetectors()
+			runDetectors(&dectectors, args, func(apa *apa.AutoPerfAssistant) error {
+				return apa.DoReport(dectectors, htmlPath)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&htmlPath, "html", "", "The output html file")
+	parent.AddCommand(cmd)
+}
+
+func registerExport(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Analyze like timeline, export the periods and events as grafana annotations, default features: all",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{"all"}
+			}
+			dectectors := newDetectors()
+			runDetectors(&dectectors, args, func(apa *apa.AutoPerfAssistant) error {
+				return apa.DoExportGrafana(dectectors, grafanaExport)
 			})
 		},
 	}
+	cmd.Flags().StringVar(&grafanaExport.Path, "grafana-annotations", "", "Write grafana annotations json into this file, '-' means stdout")
+	cmd.Flags().StringVar(&grafanaExport.URL, "grafana-url", "", "Post the annotations to this grafana, example: http://127.0.0.1:3000")
+	cmd.Flags().StringVar(&grafanaExport.Token, "grafana-token", "", "Grafana api token, default is env GRAFANA_TOKEN")
+	cmd.Flags().StringVar(&grafanaExport.DashboardUID, "grafana-dashboard", "", "Attach the annotations to this dashboard uid, empty means organization annotations")
+	cmd.Flags().IntVar(&grafanaExport.PanelID, "grafana-panel", 0, "Attach the annotations to this panel id of the dashboard")
+	cmd.Flags().StringSliceVar(&grafanaExport.Tags, "grafana-tags", nil, "Extra tags of the annotations, the tags 'tiperf', 'tiperf-run:<time>', 'period', 'event' and detector names are always attached")
 	parent.AddCommand(cmd)
 }
@@ -5,5 +5,6 @@ go 1.13
 require (
 	github.com/prometheus/client_golang v1.5.1
 	github.com/prometheus/common v0.9.1
-	github.com/spf13/cobra v1.0.0 // indirect
+	github.com/spf13/cobra v1.0.0
+	go.etcd.io/bbolt v1.3.5
 )